@@ -5,6 +5,7 @@
 package mockpeerstore
 
 import (
+	context "context"
 	gomock "github.com/golang/mock/gomock"
 	core "github.com/uber/kraken/core"
 	reflect "reflect"
@@ -33,31 +34,47 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// CountPeers mocks base method
+func (m *MockStore) CountPeers(arg0 context.Context, arg1 core.InfoHash) (int, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountPeers", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CountPeers indicates an expected call of CountPeers
+func (mr *MockStoreMockRecorder) CountPeers(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountPeers", reflect.TypeOf((*MockStore)(nil).CountPeers), arg0, arg1)
+}
+
 // GetPeers mocks base method
-func (m *MockStore) GetPeers(arg0 core.InfoHash, arg1 int) ([]*core.PeerInfo, error) {
+func (m *MockStore) GetPeers(arg0 context.Context, arg1 core.InfoHash, arg2 int) ([]*core.PeerInfo, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPeers", arg0, arg1)
+	ret := m.ctrl.Call(m, "GetPeers", arg0, arg1, arg2)
 	ret0, _ := ret[0].([]*core.PeerInfo)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetPeers indicates an expected call of GetPeers
-func (mr *MockStoreMockRecorder) GetPeers(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) GetPeers(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPeers", reflect.TypeOf((*MockStore)(nil).GetPeers), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPeers", reflect.TypeOf((*MockStore)(nil).GetPeers), arg0, arg1, arg2)
 }
 
 // UpdatePeer mocks base method
-func (m *MockStore) UpdatePeer(arg0 core.InfoHash, arg1 *core.PeerInfo) error {
+func (m *MockStore) UpdatePeer(arg0 context.Context, arg1 core.InfoHash, arg2 *core.PeerInfo) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdatePeer", arg0, arg1)
+	ret := m.ctrl.Call(m, "UpdatePeer", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdatePeer indicates an expected call of UpdatePeer
-func (mr *MockStoreMockRecorder) UpdatePeer(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) UpdatePeer(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePeer", reflect.TypeOf((*MockStore)(nil).UpdatePeer), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePeer", reflect.TypeOf((*MockStore)(nil).UpdatePeer), arg0, arg1, arg2)
 }
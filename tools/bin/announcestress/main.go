@@ -0,0 +1,57 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/uber/kraken/utils/log"
+)
+
+// announcestress generates synthetic announce load against a running tracker
+// and reports announce latency percentiles, error rate, storage throughput and
+// the breakdown per dc.
+func main() {
+	addr := flag.String("tracker", "", "tracker address (host:port)")
+	workers := flag.Int("workers", 50, "number of concurrent announcers")
+	rate := flag.Int("rate", 1000, "target announces per second")
+	duration := flag.Duration("duration", 30*time.Second, "how long to generate load for")
+	swarms := flag.Int("swarms", 100, "number of unique info hashes")
+	peersPerSwarm := flag.Int("peers", 20, "number of peers per swarm")
+	dcs := flag.String("dcs", "zone1:1", "weighted dcs to spread peers across, e.g. dc1:3,dc2:1")
+	flag.Parse()
+
+	if *addr == "" {
+		log.Fatal("-tracker required")
+	}
+	dcList, err := parseDCs(*dcs)
+	if err != nil {
+		log.Fatalf("-dcs: %s", err)
+	}
+
+	r, err := run(*addr, config{
+		workers:       *workers,
+		rate:          *rate,
+		duration:      *duration,
+		swarms:        *swarms,
+		peersPerSwarm: *peersPerSwarm,
+		dcs:           dcList,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	r.print(os.Stdout)
+}
@@ -0,0 +1,269 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/tracker/announceclient"
+)
+
+// dc is a data center synthetic peers are spread across, weighted relative to
+// other dcs.
+type dc struct {
+	name   string
+	weight int
+}
+
+// parseDCs parses a dc distribution of the form "dc1:3,dc2:1".
+func parseDCs(s string) ([]dc, error) {
+	var dcs []dc
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid dc %q: expected name:weight", part)
+		}
+		w, err := strconv.Atoi(kv[1])
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("invalid dc %q: weight must be a positive integer", part)
+		}
+		dcs = append(dcs, dc{kv[0], w})
+	}
+	return dcs, nil
+}
+
+// config defines the shape of the synthetic announce load.
+type config struct {
+	workers       int
+	rate          int
+	duration      time.Duration
+	swarms        int
+	peersPerSwarm int
+	dcs           []dc
+}
+
+func (c config) validate() error {
+	if c.workers <= 0 || c.swarms <= 0 || c.peersPerSwarm <= 0 {
+		return errors.New("workers, swarms and peers must be positive")
+	}
+	// The ticker interval is time.Second / rate, which must be non-zero.
+	if c.rate <= 0 || c.rate > int(time.Second) {
+		return fmt.Errorf("rate must be in [1, %d]", int(time.Second))
+	}
+	if len(c.dcs) == 0 {
+		return errors.New("at least one dc required")
+	}
+	return nil
+}
+
+// dcFor spreads the peers of each swarm across dcs in proportion to their
+// weights.
+func (c config) dcFor(peer int) string {
+	var total int
+	for _, d := range c.dcs {
+		total += d.weight
+	}
+	i := peer % total
+	for _, d := range c.dcs {
+		if i < d.weight {
+			return d.name
+		}
+		i -= d.weight
+	}
+	panic("unreachable")
+}
+
+type swarmPeer struct {
+	dc     string
+	client announceclient.Client
+}
+
+type swarm struct {
+	digest   core.Digest
+	infoHash core.InfoHash
+	peers    []swarmPeer
+}
+
+// dcStats summarizes the peers and announces of a single dc.
+type dcStats struct {
+	peers     int
+	announces int
+	errors    int
+}
+
+// report summarizes the results of a stress run.
+type report struct {
+	total     int
+	errors    int
+	elapsed   time.Duration
+	latencies []time.Duration
+
+	// Successful announces, and those of incomplete peers which requested a
+	// handout. These count announces rather than storage operations, which the
+	// tracker does not expose.
+	succeeded int
+	handouts  int
+
+	dcs map[string]*dcStats
+}
+
+// percentile returns the p-th percentile latency, where p is in [0, 100].
+func (r *report) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.latencies)-1) * p / 100)
+	return r.latencies[i]
+}
+
+func (r *report) perSecond(n int) float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(n) / r.elapsed.Seconds()
+}
+
+func (r *report) print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "announces\terrors\terror rate\tthroughput\tp50\tp95\tp99\tok announces\thandout announces")
+	var errorRate float64
+	if r.total > 0 {
+		errorRate = float64(r.errors) / float64(r.total)
+	}
+	fmt.Fprintf(tw, "%d\t%d\t%.2f%%\t%.1f/s\t%s\t%s\t%s\t%.1f/s\t%.1f/s\n",
+		r.total, r.errors, 100*errorRate, r.perSecond(r.total),
+		r.percentile(50), r.percentile(95), r.percentile(99),
+		r.perSecond(r.succeeded), r.perSecond(r.handouts))
+	fmt.Fprintln(tw)
+
+	var names []string
+	for name := range r.dcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(tw, "dc\tpeers\tannounces\terrors")
+	for _, name := range names {
+		d := r.dcs[name]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", name, d.peers, d.announces, d.errors)
+	}
+	tw.Flush()
+}
+
+func newSwarms(addr string, c config) ([]*swarm, error) {
+	hosts, err := hostlist.New(hostlist.Config{Static: []string{addr}})
+	if err != nil {
+		return nil, fmt.Errorf("host list: %s", err)
+	}
+	ring := hashring.NoopPassiveRing(hosts)
+
+	swarms := make([]*swarm, c.swarms)
+	for i := range swarms {
+		s := &swarm{
+			digest:   core.DigestFixture(),
+			infoHash: core.InfoHashFixture(),
+		}
+		for j := 0; j < c.peersPerSwarm; j++ {
+			pctx := core.PeerContextFixture()
+			pctx.Zone = c.dcFor(j)
+			s.peers = append(s.peers, swarmPeer{pctx.Zone, announceclient.New(pctx, ring, nil)})
+		}
+		swarms[i] = s
+	}
+	return swarms, nil
+}
+
+// run announces against the tracker at addr at the configured rate until the
+// configured duration elapses, and reports the observed latencies.
+func run(addr string, c config) (*report, error) {
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err)
+	}
+	swarms, err := newSwarms(addr, c)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	r := &report{dcs: make(map[string]*dcStats)}
+	for _, s := range swarms {
+		for _, p := range s.peers {
+			if r.dcs[p.dc] == nil {
+				r.dcs[p.dc] = &dcStats{}
+			}
+			r.dcs[p.dc].peers++
+		}
+	}
+
+	jobs := make(chan *swarm)
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range jobs {
+				p := s.peers[rand.Intn(len(s.peers))]
+				complete := rand.Intn(2) == 0
+				start := time.Now()
+				_, _, err := p.client.Announce(s.digest, s.infoHash, complete, announceclient.V2)
+				latency := time.Since(start)
+
+				mu.Lock()
+				r.total++
+				r.dcs[p.dc].announces++
+				if err != nil {
+					r.errors++
+					r.dcs[p.dc].errors++
+				} else {
+					r.latencies = append(r.latencies, latency)
+					r.succeeded++
+					if !complete {
+						r.handouts++
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	start := time.Now()
+	ticker := time.NewTicker(time.Second / time.Duration(c.rate))
+	deadline := time.After(c.duration)
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			jobs <- swarms[rand.Intn(len(swarms))]
+		case <-deadline:
+			break loop
+		}
+	}
+	ticker.Stop()
+	close(jobs)
+	wg.Wait()
+	r.elapsed = time.Since(start)
+
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	return r, nil
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/tracker/trackerserver"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunAgainstInMemoryTracker(t *testing.T) {
+	require := require.New(t)
+
+	addr, stop := testutil.StartServer(trackerserver.Fixture().Handler())
+	defer stop()
+
+	r, err := run(addr, config{
+		workers:       20,
+		rate:          1000,
+		duration:      time.Second,
+		swarms:        10,
+		peersPerSwarm: 4,
+		dcs:           []dc{{"dc1", 3}, {"dc2", 1}},
+	})
+	require.NoError(err)
+	require.Zero(r.errors)
+	require.True(r.total > 0)
+	require.Len(r.latencies, r.total)
+	require.True(r.percentile(50) <= r.percentile(99))
+	require.Equal(r.total, r.succeeded)
+	require.True(r.handouts <= r.succeeded)
+
+	// The achieved rate stays close to the target.
+	require.InEpsilon(1000, r.total, 0.2)
+
+	// Each swarm spreads its 4 peers 3:1 across dcs.
+	require.Len(r.dcs, 2)
+	require.Equal(30, r.dcs["dc1"].peers)
+	require.Equal(10, r.dcs["dc2"].peers)
+	require.Equal(r.total, r.dcs["dc1"].announces+r.dcs["dc2"].announces)
+
+	var out bytes.Buffer
+	r.print(&out)
+	require.Contains(out.String(), "p99")
+	require.Contains(out.String(), "ok announces")
+	require.Contains(out.String(), "dc2")
+}
+
+func TestRunRejectsInvalidConfig(t *testing.T) {
+	valid := config{
+		workers:       1,
+		rate:          1,
+		duration:      time.Second,
+		swarms:        1,
+		peersPerSwarm: 1,
+		dcs:           []dc{{"dc1", 1}},
+	}
+	tests := []struct {
+		desc   string
+		modify func(*config)
+	}{
+		{"zero workers", func(c *config) { c.workers = 0 }},
+		{"zero rate", func(c *config) { c.rate = 0 }},
+		{"rate above ticker resolution", func(c *config) { c.rate = int(time.Second) + 1 }},
+		{"no dcs", func(c *config) { c.dcs = nil }},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			c := valid
+			test.modify(&c)
+			_, err := run("localhost:0", c)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestParseDCs(t *testing.T) {
+	require := require.New(t)
+
+	dcs, err := parseDCs("dc1:3,dc2:1")
+	require.NoError(err)
+	require.Equal([]dc{{"dc1", 3}, {"dc2", 1}}, dcs)
+
+	for _, s := range []string{"", "dc1", "dc1:0", "dc1:x", ":1"} {
+		_, err := parseDCs(s)
+		require.Error(err, s)
+	}
+}
@@ -15,11 +15,11 @@ package announceclient
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"time"
 
 	"github.com/uber/kraken/core"
@@ -36,6 +36,14 @@ type Request struct {
 	Digest   *core.Digest   `json:"digest"` // Optional (for now).
 	InfoHash core.InfoHash  `json:"info_hash"`
 	Peer     *core.PeerInfo `json:"peer"`
+
+	// NumWant is the number of peers the client wants, capped by the tracker's
+	// handout limit. Origins count towards NumWant, but at least one origin is
+	// included if there are any. If unset, the tracker default limit applies
+	// and all origins are included on top of it. Zero requests no peers, e.g.
+	// for seeders which only need to register themselves. Negative values fall
+	// back to the default.
+	NumWant *int `json:"num_want,omitempty"`
 }
 
 // GetDigest is a backwards compatible accessor of the request digest.
@@ -54,6 +62,26 @@ func (r *Request) GetDigest() (core.Digest, error) {
 type Response struct {
 	Peers    []*core.PeerInfo `json:"peers"`
 	Interval time.Duration    `json:"interval"`
+
+	// MinInterval is the minimum time clients should wait before announcing
+	// again.
+	MinInterval time.Duration `json:"min_interval,omitempty"`
+
+	// Fingerprint identifies the set of peers in the response. Clients may send
+	// it back as If-None-Match to receive 304 if the set is unchanged.
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// Truncated is set if peers were dropped to fit the response size limit.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// nextInterval returns the interval until the next announce, which is never
+// shorter than the minimum interval the tracker allows.
+func (r *Response) nextInterval() time.Duration {
+	if r.Interval < r.MinInterval {
+		return r.MinInterval
+	}
+	return r.Interval
 }
 
 // Client defines a client for announcing and getting peers.
@@ -76,6 +104,20 @@ func New(pctx core.PeerContext, ring hashring.PassiveRing, tls *tls.Config) Clie
 	return &client{pctx, ring, tls}
 }
 
+// _timeout bounds each announce attempt.
+const _timeout = 10 * time.Second
+
+// timeoutHeaders returns the time remaining until the deadline of ctx as an
+// X-Request-Timeout header, such that the tracker abandons work on announces
+// the client has given up on. Returns no headers if ctx has no deadline.
+func timeoutHeaders(ctx context.Context) map[string]string {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	return map[string]string{"X-Request-Timeout": time.Until(deadline).String()}
+}
+
 // Announce versionss.
 const (
 	V1 = 1
@@ -91,7 +133,8 @@ func getEndpoint(version int, addr string, h core.InfoHash) (method, url string)
 
 // Announce announces the torrent identified by (d, h) with the number of
 // downloaded bytes. Returns a list of all other peers announcing for said torrent,
-// sorted by priority, and the interval for the next announce.
+// sorted by priority, and the interval for the next announce, which respects the
+// tracker's minimum interval.
 func (c *client) Announce(
 	d core.Digest,
 	h core.InfoHash,
@@ -107,15 +150,9 @@ func (c *client) Announce(
 	if err != nil {
 		return nil, 0, fmt.Errorf("marshal request: %s", err)
 	}
-	var httpResp *http.Response
 	for _, addr := range c.ring.Locations(d) {
-		method, url := getEndpoint(version, addr, h)
-		httpResp, err = httputil.Send(
-			method,
-			url,
-			httputil.SendBody(bytes.NewReader(body)),
-			httputil.SendTimeout(10*time.Second),
-			httputil.SendTLS(c.tls))
+		var resp *Response
+		resp, err = c.send(version, addr, h, body)
 		if err != nil {
 			if httputil.IsNetworkError(err) {
 				c.ring.Failed(addr)
@@ -123,16 +160,34 @@ func (c *client) Announce(
 			}
 			return nil, 0, err
 		}
-		defer httpResp.Body.Close()
-		var resp Response
-		if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
-			return nil, 0, fmt.Errorf("decode response: %s", err)
-		}
-		return resp.Peers, resp.Interval, nil
+		return resp.Peers, resp.nextInterval(), nil
 	}
 	return nil, 0, err
 }
 
+func (c *client) send(version int, addr string, h core.InfoHash, body []byte) (*Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), _timeout)
+	defer cancel()
+
+	method, url := getEndpoint(version, addr, h)
+	httpResp, err := httputil.Send(
+		method,
+		url,
+		httputil.SendBody(bytes.NewReader(body)),
+		httputil.SendContext(ctx),
+		httputil.SendHeaders(timeoutHeaders(ctx)),
+		httputil.SendTLS(c.tls))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	var resp Response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("decode response: %s", err)
+	}
+	return &resp, nil
+}
+
 // DisabledClient rejects all announces. Suitable for origin peers which should
 // not be announcing.
 type DisabledClient struct{}
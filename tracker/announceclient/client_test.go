@@ -0,0 +1,98 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package announceclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/lib/hashring"
+	"github.com/uber/kraken/lib/hostlist"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutHeaders(t *testing.T) {
+	require := require.New(t)
+
+	require.Empty(timeoutHeaders(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	timeout, err := time.ParseDuration(timeoutHeaders(ctx)["X-Request-Timeout"])
+	require.NoError(err)
+	require.True(timeout > 0 && timeout <= 5*time.Second, "timeout %s", timeout)
+}
+
+func TestAnnounceSendsRemainingTimeout(t *testing.T) {
+	require := require.New(t)
+
+	headers := make(chan string, 1)
+	addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Get("X-Request-Timeout")
+		json.NewEncoder(w).Encode(&Response{Interval: time.Second})
+	}))
+	defer stop()
+
+	client := New(core.PeerContextFixture(), hashring.NoopPassiveRing(hostlist.Fixture(addr)), nil)
+
+	blob := core.NewBlobFixture()
+	_, interval, err := client.Announce(blob.Digest, blob.MetaInfo.InfoHash(), false, V2)
+	require.NoError(err)
+	require.Equal(time.Second, interval)
+
+	timeout, err := time.ParseDuration(<-headers)
+	require.NoError(err)
+	require.True(timeout > 0 && timeout <= _timeout, "timeout %s", timeout)
+}
+
+func TestAnnounceHonorsMinInterval(t *testing.T) {
+	tests := []struct {
+		desc        string
+		interval    time.Duration
+		minInterval time.Duration
+		expected    time.Duration
+	}{
+		{"unset", 3 * time.Second, 0, 3 * time.Second},
+		{"below interval", 3 * time.Second, time.Second, 3 * time.Second},
+		{"above interval", time.Second, 2 * time.Second, 2 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			addr, stop := testutil.StartServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(&Response{
+					Interval:    test.interval,
+					MinInterval: test.minInterval,
+				})
+			}))
+			defer stop()
+
+			client := New(
+				core.PeerContextFixture(), hashring.NoopPassiveRing(hostlist.Fixture(addr)), nil)
+
+			blob := core.NewBlobFixture()
+			_, interval, err := client.Announce(blob.Digest, blob.MetaInfo.InfoHash(), false, V1)
+			require.NoError(err)
+			require.Equal(test.expected, interval)
+		})
+	}
+}
@@ -104,8 +104,11 @@ func run() {
 	r := blobclient.NewClientResolver(blobclient.NewProvider(blobclient.WithTLS(tls)), origins)
 	originCluster := blobclient.NewClusterClient(r)
 
-	server := trackerserver.New(
+	server, err := trackerserver.New(
 		config.TrackerServer, stats, policy, peerStore, originStore, originCluster)
+	if err != nil {
+		log.Fatalf("Error creating tracker server: %s", err)
+	}
 	go func() {
 		log.Fatal(server.ListenAndServe())
 	}()
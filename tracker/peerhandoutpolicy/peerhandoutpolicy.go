@@ -4,7 +4,7 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//     http://www.apache.org/licenses/LICENSE-2.0
+//	http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
@@ -16,6 +16,7 @@ package peerhandoutpolicy
 import (
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/uber-go/tally"
 
@@ -35,6 +36,7 @@ type assignmentPolicy interface {
 
 // PriorityPolicy wraps an assignmentPolicy and uses it to sort lists of peers.
 type PriorityPolicy struct {
+	name   string
 	stats  tally.Scope
 	policy assignmentPolicy
 }
@@ -42,6 +44,7 @@ type PriorityPolicy struct {
 // NewPriorityPolicy returns a PriorityPolicy that assigns priorities using the given priority policy.
 func NewPriorityPolicy(stats tally.Scope, priorityPolicy string) (*PriorityPolicy, error) {
 	p := &PriorityPolicy{
+		name: priorityPolicy,
 		stats: stats.Tagged(map[string]string{
 			"module":   "peerhandoutpolicy",
 			"priority": priorityPolicy,
@@ -60,9 +63,21 @@ func NewPriorityPolicy(stats tally.Scope, priorityPolicy string) (*PriorityPolic
 	return p, nil
 }
 
+// Name returns the name of the configured priority policy.
+func (p *PriorityPolicy) Name() string {
+	return p.name
+}
+
+// AssignPriority returns the priority and label the policy assigns to peer.
+// Lower priorities are handed out first.
+func (p *PriorityPolicy) AssignPriority(peer *core.PeerInfo) (priority int, label string) {
+	return p.policy.assignPriority(peer)
+}
+
 // SortPeers returns the given list of peers sorted by the priority assigned to them
 // by the priorityPolicy. Excludes the source peer from the list.
 func (p *PriorityPolicy) SortPeers(source *core.PeerInfo, peers []*core.PeerInfo) []*core.PeerInfo {
+	start := time.Now()
 
 	peerPriorities := make([]*peerPriorityInfo, 0, len(peers))
 	for k := 0; k < len(peers); k++ {
@@ -95,5 +110,7 @@ func (p *PriorityPolicy) SortPeers(source *core.PeerInfo, peers []*core.PeerInfo
 		}).Gauge("count").Update(float64(count))
 	}
 
+	p.stats.Timer("sort_latency").Record(time.Since(start))
+
 	return peers
 }
@@ -19,6 +19,7 @@ import (
 	"github.com/uber/kraken/core"
 
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 )
 
 func TestPriorityPolicyRemoveSource(t *testing.T) {
@@ -39,3 +40,24 @@ func TestPriorityPolicyRemoveSource(t *testing.T) {
 		require.NotEqual(src, sorted[k])
 	}
 }
+
+func TestPriorityPolicySortLatencyMetric(t *testing.T) {
+	require := require.New(t)
+
+	stats := tally.NewTestScope("", nil)
+	policy, err := NewPriorityPolicy(stats, _defaultPolicy)
+	require.NoError(err)
+	require.Equal(_defaultPolicy, policy.Name())
+
+	policy.SortPeers(core.PeerInfoFixture(), []*core.PeerInfo{core.PeerInfoFixture()})
+
+	var found bool
+	for _, timer := range stats.Snapshot().Timers() {
+		if timer.Name() == "sort_latency" {
+			found = true
+			require.Len(timer.Values(), 1)
+			require.Equal(_defaultPolicy, timer.Tags()["priority"])
+		}
+	}
+	require.True(found)
+}
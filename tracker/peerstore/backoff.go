@@ -0,0 +1,93 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/garyburd/redigo/redis"
+)
+
+// dialBackoff spaces out Redis dial attempts after failures, such that a
+// restarting Redis is not overwhelmed by reconnects from every pool at once.
+// Delays grow exponentially per consecutive failure with random jitter, and
+// reset after a successful dial. While backing off, a single probe dial is
+// allowed per delay and concurrent attempts fail fast.
+type dialBackoff struct {
+	config RedisConfig
+	clk    clock.Clock
+	dialer func() (redis.Conn, error)
+
+	mu      sync.Mutex
+	delay   time.Duration
+	next    time.Time
+	probing bool
+}
+
+func newDialBackoff(
+	config RedisConfig, clk clock.Clock, dialer func() (redis.Conn, error)) *dialBackoff {
+
+	return &dialBackoff{config: config, clk: clk, dialer: dialer}
+}
+
+func (b *dialBackoff) dial() (redis.Conn, error) {
+	b.mu.Lock()
+	if wait := b.next.Sub(b.clk.Now()); wait > 0 {
+		b.mu.Unlock()
+		return nil, fmt.Errorf("dial backoff: next attempt in %s", wait)
+	}
+	if b.probing {
+		b.mu.Unlock()
+		return nil, errors.New("dial backoff: probe dial in flight")
+	}
+	// Dials are only serialized after a failure, such that a healthy pool can
+	// still open connections in parallel.
+	probe := b.delay > 0
+	b.probing = probe
+	b.mu.Unlock()
+
+	c, err := b.dialer()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+	}
+	if err != nil {
+		if b.next.After(b.clk.Now()) {
+			// A concurrent dial already failed and backed off.
+			return nil, err
+		}
+		if b.delay == 0 {
+			b.delay = b.config.DialBackoffInitial
+		} else {
+			b.delay = time.Duration(float64(b.delay) * *b.config.DialBackoffMultiplier)
+		}
+		if b.delay > b.config.DialBackoffMax {
+			b.delay = b.config.DialBackoffMax
+		}
+		jitter := time.Duration(rand.Float64() * *b.config.DialBackoffJitter * float64(b.delay))
+		b.next = b.clk.Now().Add(b.delay + jitter)
+		return nil, err
+	}
+	b.delay = 0
+	b.next = time.Time{}
+	return c, nil
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package peerstore
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andres-erbsen/clock"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/require"
+)
+
+func floatPtr(f float64) *float64 { return &f }
+
+func backoffConfigFixture() RedisConfig {
+	return RedisConfig{
+		DialBackoffInitial:    100 * time.Millisecond,
+		DialBackoffMax:        time.Second,
+		DialBackoffMultiplier: floatPtr(2),
+		DialBackoffJitter:     floatPtr(0),
+	}
+}
+
+func TestDialBackoffGrowsExponentiallyUntilMax(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	var attempts int
+	b := newDialBackoff(backoffConfigFixture(), clk, func() (redis.Conn, error) {
+		attempts++
+		return nil, errors.New("some error")
+	})
+
+	for _, delay := range []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	} {
+		_, err := b.dial()
+		require.Error(err)
+
+		// Attempts before the delay has elapsed are refused without dialing.
+		n := attempts
+		clk.Add(delay - time.Millisecond)
+		_, err = b.dial()
+		require.Error(err)
+		require.Equal(n, attempts)
+
+		clk.Add(time.Millisecond)
+	}
+}
+
+func TestDialBackoffResetsAfterSuccess(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	fail := true
+	b := newDialBackoff(backoffConfigFixture(), clk, func() (redis.Conn, error) {
+		if fail {
+			return nil, errors.New("some error")
+		}
+		return nil, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		_, err := b.dial()
+		require.Error(err)
+		clk.Add(time.Second)
+	}
+
+	fail = false
+	_, err := b.dial()
+	require.NoError(err)
+
+	fail = true
+	_, err = b.dial()
+	require.Error(err)
+	require.Equal(100*time.Millisecond, b.delay)
+}
+
+func TestDialBackoffJitter(t *testing.T) {
+	require := require.New(t)
+
+	config := backoffConfigFixture()
+	config.DialBackoffJitter = floatPtr(0.5)
+
+	for i := 0; i < 100; i++ {
+		clk := clock.NewMock()
+		b := newDialBackoff(config, clk, func() (redis.Conn, error) {
+			return nil, errors.New("some error")
+		})
+		_, err := b.dial()
+		require.Error(err)
+
+		wait := b.next.Sub(clk.Now())
+		require.True(wait >= 100*time.Millisecond, "wait %s", wait)
+		require.True(wait <= 150*time.Millisecond, "wait %s", wait)
+	}
+}
+
+func TestDialBackoffSingleProbePerWindow(t *testing.T) {
+	require := require.New(t)
+
+	clk := clock.NewMock()
+	var mu sync.Mutex
+	var attempts int
+	release := make(chan struct{})
+	b := newDialBackoff(backoffConfigFixture(), clk, func() (redis.Conn, error) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		<-release
+		return nil, errors.New("some error")
+	})
+
+	// Enter backoff with an initial failure.
+	close(release)
+	_, err := b.dial()
+	require.Error(err)
+	require.Equal(1, attempts)
+
+	for _, delay := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond} {
+		clk.Add(delay)
+		release = make(chan struct{})
+
+		// Every pool waiter dials once the delay elapses, but only the
+		// first reaches Redis while the rest fail fast.
+		errc := make(chan error)
+		for i := 0; i < 50; i++ {
+			go func() {
+				_, err := b.dial()
+				errc <- err
+			}()
+		}
+		for i := 0; i < 49; i++ {
+			require.Error(<-errc)
+		}
+		close(release)
+		require.Error(<-errc)
+	}
+	require.Equal(3, attempts)
+}
+
+func TestDialBackoffConstantDelay(t *testing.T) {
+	require := require.New(t)
+
+	config := backoffConfigFixture()
+	config.DialBackoffMultiplier = floatPtr(1)
+
+	clk := clock.NewMock()
+	b := newDialBackoff(config, clk, func() (redis.Conn, error) {
+		return nil, errors.New("some error")
+	})
+	for i := 0; i < 3; i++ {
+		_, err := b.dial()
+		require.Error(err)
+		require.Equal(100*time.Millisecond, b.next.Sub(clk.Now()))
+		clk.Add(100 * time.Millisecond)
+	}
+}
+
+func TestRedisConfigKeepsExplicitZeroJitter(t *testing.T) {
+	require := require.New(t)
+
+	config := RedisConfig{DialBackoffJitter: floatPtr(0)}
+	config.applyDefaults()
+	require.Equal(0.0, *config.DialBackoffJitter)
+	require.Equal(2.0, *config.DialBackoffMultiplier)
+
+	config = RedisConfig{}
+	config.applyDefaults()
+	require.Equal(0.5, *config.DialBackoffJitter)
+}
+
+func TestNewRedisStoreRejectsInvalidBackoff(t *testing.T) {
+	tests := []struct {
+		desc   string
+		modify func(*RedisConfig)
+	}{
+		{"zero multiplier", func(c *RedisConfig) { c.DialBackoffMultiplier = floatPtr(0) }},
+		{"shrinking multiplier", func(c *RedisConfig) { c.DialBackoffMultiplier = floatPtr(0.5) }},
+		{"negative jitter", func(c *RedisConfig) { c.DialBackoffJitter = floatPtr(-1) }},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			config := RedisConfig{Addr: "localhost:0"}
+			test.modify(&config)
+			_, err := NewRedisStore(config, clock.New())
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "invalid config")
+		})
+	}
+}
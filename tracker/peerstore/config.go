@@ -34,6 +34,16 @@ type RedisConfig struct {
 	MaxIdleConns      int           `yaml:"max_idle_conns"`
 	MaxActiveConns    int           `yaml:"max_active_conns"`
 	IdleConnTimeout   time.Duration `yaml:"idle_conn_timeout"`
+
+	// Backoff between dial attempts after consecutive dial failures. Each
+	// delay is DialBackoffMultiplier times the previous one, capped at
+	// DialBackoffMax, plus up to DialBackoffJitter times the delay at random.
+	// The multiplier must be at least 1. The multiplier and jitter are
+	// pointers such that an explicit 0 is distinct from unset.
+	DialBackoffInitial    time.Duration `yaml:"dial_backoff_initial"`
+	DialBackoffMax        time.Duration `yaml:"dial_backoff_max"`
+	DialBackoffMultiplier *float64      `yaml:"dial_backoff_multiplier"`
+	DialBackoffJitter     *float64      `yaml:"dial_backoff_jitter"`
 }
 
 func (c *RedisConfig) applyDefaults() {
@@ -61,4 +71,18 @@ func (c *RedisConfig) applyDefaults() {
 	if c.IdleConnTimeout == 0 {
 		c.IdleConnTimeout = 60 * time.Second
 	}
+	if c.DialBackoffInitial == 0 {
+		c.DialBackoffInitial = 100 * time.Millisecond
+	}
+	if c.DialBackoffMax == 0 {
+		c.DialBackoffMax = 10 * time.Second
+	}
+	if c.DialBackoffMultiplier == nil {
+		multiplier := 2.0
+		c.DialBackoffMultiplier = &multiplier
+	}
+	if c.DialBackoffJitter == nil {
+		jitter := 0.5
+		c.DialBackoffJitter = &jitter
+	}
 }
@@ -14,6 +14,7 @@
 package peerstore
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
@@ -31,6 +32,28 @@ func peerSetKey(h core.InfoHash, window int64) string {
 	return fmt.Sprintf("peerset:%s:%d", h.String(), window)
 }
 
+// identitySetKey is the key of the set of peer identities in a window. Unlike
+// the peer set, members do not include the complete bit, so a peer which
+// completes between windows is not counted twice.
+func identitySetKey(h core.InfoHash, window int64) string {
+	return fmt.Sprintf("identityset:%s:%d", h.String(), window)
+}
+
+// seederSetKey is the key of the set of complete peer identities in a window,
+// which allows counting seeders without reading the peer set.
+func seederSetKey(h core.InfoHash, window int64) string {
+	return fmt.Sprintf("seederset:%s:%d", h.String(), window)
+}
+
+// countKey is the key which CountPeers temporarily unions sets into.
+func countKey(h core.InfoHash, kind string) string {
+	return fmt.Sprintf("count:%s:%s", kind, h.String())
+}
+
+func serializeIdentity(p *core.PeerInfo) string {
+	return fmt.Sprintf("%s:%s:%d", p.PeerID.String(), p.IP, p.Port)
+}
+
 func serializePeer(p *core.PeerInfo) string {
 	var completeBit int
 	if p.Complete {
@@ -46,21 +69,24 @@ type peerIdentity struct {
 }
 
 func deserializePeer(s string) (id peerIdentity, complete bool, err error) {
+	// IPv6 addresses contain colons, so the ip is everything between the peer
+	// id and the trailing port and complete bit.
 	parts := strings.Split(s, ":")
-	if len(parts) != 4 {
+	if len(parts) < 4 {
 		return id, false, fmt.Errorf("invalid peer encoding: expected 'pid:ip:port:complete'")
 	}
+	n := len(parts)
 	peerID, err := core.NewPeerID(parts[0])
 	if err != nil {
 		return id, false, fmt.Errorf("parse peer id: %s", err)
 	}
-	ip := parts[1]
-	port, err := strconv.Atoi(parts[2])
+	ip := strings.Join(parts[1:n-2], ":")
+	port, err := strconv.Atoi(parts[n-2])
 	if err != nil {
 		return id, false, fmt.Errorf("parse port: %s", err)
 	}
 	id = peerIdentity{peerID, ip, port}
-	complete = parts[3] == "1"
+	complete = parts[n-1] == "1"
 	return id, complete, nil
 }
 
@@ -78,19 +104,29 @@ func NewRedisStore(config RedisConfig, clk clock.Clock) (*RedisStore, error) {
 	if config.Addr == "" {
 		return nil, errors.New("invalid config: missing addr")
 	}
+	if *config.DialBackoffMultiplier < 1 {
+		return nil, errors.New("invalid config: dial_backoff_multiplier must be at least 1")
+	}
+	if *config.DialBackoffJitter < 0 {
+		return nil, errors.New("invalid config: dial_backoff_jitter must not be negative")
+	}
+
+	dial := func() (redis.Conn, error) {
+		// TODO Add options
+		return redis.Dial(
+			"tcp",
+			config.Addr,
+			redis.DialConnectTimeout(config.DialTimeout),
+			redis.DialReadTimeout(config.ReadTimeout),
+			redis.DialWriteTimeout(config.WriteTimeout))
+	}
 
 	s := &RedisStore{
 		config: config,
 		pool: &redis.Pool{
-			Dial: func() (redis.Conn, error) {
-				// TODO Add options
-				return redis.Dial(
-					"tcp",
-					config.Addr,
-					redis.DialConnectTimeout(config.DialTimeout),
-					redis.DialReadTimeout(config.ReadTimeout),
-					redis.DialWriteTimeout(config.WriteTimeout))
-			},
+			// Backoff runs on real time, independent of the clock which
+			// determines peer set windows.
+			Dial:        newDialBackoff(config, clock.New(), dial).dial,
 			MaxIdle:     config.MaxIdleConns,
 			MaxActive:   config.MaxActiveConns,
 			IdleTimeout: config.IdleConnTimeout,
@@ -123,9 +159,21 @@ func (s *RedisStore) peerSetWindows() []int64 {
 	return ws
 }
 
+// getConn returns a pooled connection, giving up if ctx is done before one
+// becomes available.
+func (s *RedisStore) getConn(ctx context.Context) (redis.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.pool.GetContext(ctx)
+}
+
 // UpdatePeer writes p to Redis with a TTL.
-func (s *RedisStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
-	c := s.pool.Get()
+func (s *RedisStore) UpdatePeer(ctx context.Context, h core.InfoHash, p *core.PeerInfo) error {
+	c, err := s.getConn(ctx)
+	if err != nil {
+		return err
+	}
 	defer c.Close()
 
 	w := s.curPeerSetWindow()
@@ -134,27 +182,94 @@ func (s *RedisStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
 	// Add p to the current window.
 	k := peerSetKey(h, w)
 
-	if err := c.Send("SADD", k, serializePeer(p)); err != nil {
-		return fmt.Errorf("send SADD: %s", err)
+	keys := []string{k, identitySetKey(h, w)}
+	members := []string{serializePeer(p), serializeIdentity(p)}
+	if p.Complete {
+		keys = append(keys, seederSetKey(h, w))
+		members = append(members, serializeIdentity(p))
 	}
-	if err := c.Send("EXPIREAT", k, expireAt); err != nil {
-		return fmt.Errorf("send EXPIREAT: %s", err)
+	for i := range keys {
+		if err := c.Send("SADD", keys[i], members[i]); err != nil {
+			return fmt.Errorf("send SADD %s: %s", keys[i], err)
+		}
+		if err := c.Send("EXPIREAT", keys[i], expireAt); err != nil {
+			return fmt.Errorf("send EXPIREAT %s: %s", keys[i], err)
+		}
 	}
 	if err := c.Flush(); err != nil {
 		return fmt.Errorf("flush: %s", err)
 	}
-	if _, err := c.Receive(); err != nil {
-		return fmt.Errorf("SADD: %s", err)
-	}
-	if _, err := c.Receive(); err != nil {
-		return fmt.Errorf("EXPIREAT: %s", err)
+	for i := range keys {
+		if _, err := c.Receive(); err != nil {
+			return fmt.Errorf("SADD %s: %s", keys[i], err)
+		}
+		if _, err := c.Receive(); err != nil {
+			return fmt.Errorf("EXPIREAT %s: %s", keys[i], err)
+		}
 	}
 	return nil
 }
 
+// CountPeers returns the number of distinct complete and incomplete peers
+// which have announced for h across the same windows GetPeers samples from,
+// without reading the peers. A peer which was complete in any window is
+// counted as complete only.
+func (s *RedisStore) CountPeers(
+	ctx context.Context, h core.InfoHash) (complete, incomplete int, err error) {
+
+	c, err := s.getConn(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer c.Close()
+
+	windows := s.peerSetWindows()
+	identityKeys := []interface{}{countKey(h, "identities")}
+	seederKeys := []interface{}{countKey(h, "seeders")}
+	for _, w := range windows {
+		identityKeys = append(identityKeys, identitySetKey(h, w))
+		seederKeys = append(seederKeys, seederSetKey(h, w))
+	}
+
+	// SUNIONSTORE returns the size of the union. Running it in a transaction
+	// ensures the temporary keys are deleted before anyone else can see them.
+	if err := c.Send("MULTI"); err != nil {
+		return 0, 0, fmt.Errorf("send MULTI: %s", err)
+	}
+	if err := c.Send("SUNIONSTORE", identityKeys...); err != nil {
+		return 0, 0, fmt.Errorf("send SUNIONSTORE identities: %s", err)
+	}
+	if err := c.Send("SUNIONSTORE", seederKeys...); err != nil {
+		return 0, 0, fmt.Errorf("send SUNIONSTORE seeders: %s", err)
+	}
+	if err := c.Send("DEL", identityKeys[0], seederKeys[0]); err != nil {
+		return 0, 0, fmt.Errorf("send DEL: %s", err)
+	}
+	result, err := redis.Values(c.Do("EXEC"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("EXEC: %s", err)
+	}
+	if len(result) != 3 {
+		return 0, 0, fmt.Errorf("EXEC: expected 3 results, got %d", len(result))
+	}
+	total, err := redis.Int(result[0], nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("SUNIONSTORE identities: %s", err)
+	}
+	seeders, err := redis.Int(result[1], nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("SUNIONSTORE seeders: %s", err)
+	}
+	// Every seeder identity is also in the identity set.
+	return seeders, total - seeders, nil
+}
+
 // GetPeers returns at most n PeerInfos associated with h.
-func (s *RedisStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
-	c := s.pool.Get()
+func (s *RedisStore) GetPeers(ctx context.Context, h core.InfoHash, n int) ([]*core.PeerInfo, error) {
+	c, err := s.getConn(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer c.Close()
 
 	// Try to sample n peers from each window in randomized order until we have
@@ -170,6 +285,9 @@ func (s *RedisStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error)
 	selected := make(map[peerIdentity]bool)
 
 	for i := 0; len(selected) < n && i < len(windows); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		k := peerSetKey(h, windows[i])
 		result, err := redis.Strings(c.Do("SRANDMEMBER", k, n-len(selected)))
 		if err == redis.ErrNil {
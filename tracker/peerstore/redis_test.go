@@ -14,6 +14,7 @@
 package peerstore
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -49,9 +50,29 @@ func TestRedisStoreGetPeersPopulatesPeerInfoFields(t *testing.T) {
 	p := core.PeerInfoFixture()
 	p.Complete = true
 
-	require.NoError(s.UpdatePeer(h, p))
+	require.NoError(s.UpdatePeer(context.Background(), h, p))
 
-	peers, err := s.GetPeers(h, 1)
+	peers, err := s.GetPeers(context.Background(), h, 1)
+	require.NoError(err)
+	require.Equal(peers, []*core.PeerInfo{p})
+}
+
+func TestRedisStoreIPv6Peer(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+
+	p := core.PeerInfoFixture()
+	p.IP = "2001:db8::1"
+
+	require.NoError(s.UpdatePeer(context.Background(), h, p))
+
+	peers, err := s.GetPeers(context.Background(), h, 1)
 	require.NoError(err)
 	require.Equal(peers, []*core.PeerInfo{p})
 }
@@ -83,10 +104,10 @@ func TestRedisStoreGetPeersFromMultipleWindows(t *testing.T) {
 		}
 		p := core.PeerInfoFixture()
 		peers = append(peers, p)
-		require.NoError(s.UpdatePeer(h, p))
+		require.NoError(s.UpdatePeer(context.Background(), h, p))
 	}
 
-	result, err := s.GetPeers(h, len(peers))
+	result, err := s.GetPeers(context.Background(), h, len(peers))
 	require.NoError(err)
 	require.Equal(core.SortedByPeerID(peers), core.SortedByPeerID(result))
 }
@@ -115,13 +136,13 @@ func TestRedisStoreGetPeersLimit(t *testing.T) {
 		if i > 0 {
 			clk.Add(time.Second)
 		}
-		require.NoError(s.UpdatePeer(h, core.PeerInfoFixture()))
+		require.NoError(s.UpdatePeer(context.Background(), h, core.PeerInfoFixture()))
 	}
 
 	// Request more peers than were added on a single window to ensure we obey the limit
 	// across multiple windows.
 	for i := 0; i < 100; i++ {
-		result, err := s.GetPeers(h, 15)
+		result, err := s.GetPeers(context.Background(), h, 15)
 		require.NoError(err)
 		require.Len(result, 15)
 	}
@@ -138,22 +159,94 @@ func TestRedisStoreGetPeersCollapsesCompleteBits(t *testing.T) {
 	h := core.InfoHashFixture()
 	p := core.PeerInfoFixture()
 
-	require.NoError(s.UpdatePeer(h, p))
+	require.NoError(s.UpdatePeer(context.Background(), h, p))
 
-	peers, err := s.GetPeers(h, 2)
+	peers, err := s.GetPeers(context.Background(), h, 2)
 	require.NoError(err)
 	require.Len(peers, 1)
 	require.False(peers[0].Complete)
 
 	p.Complete = true
-	require.NoError(s.UpdatePeer(h, p))
+	require.NoError(s.UpdatePeer(context.Background(), h, p))
 
-	peers, err = s.GetPeers(h, 2)
+	peers, err = s.GetPeers(context.Background(), h, 2)
 	require.NoError(err)
 	require.Len(peers, 1)
 	require.True(peers[0].Complete)
 }
 
+func TestRedisStoreCountPeers(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+
+	complete, incomplete, err := s.CountPeers(context.Background(), h)
+	require.NoError(err)
+	require.Equal(0, complete)
+	require.Equal(0, incomplete)
+
+	for i := 0; i < 3; i++ {
+		p := core.PeerInfoFixture()
+		p.Complete = i == 0
+		require.NoError(s.UpdatePeer(context.Background(), h, p))
+		// Repeated announces are not double counted.
+		require.NoError(s.UpdatePeer(context.Background(), h, p))
+	}
+
+	complete, incomplete, err = s.CountPeers(context.Background(), h)
+	require.NoError(err)
+	require.Equal(1, complete)
+	require.Equal(2, incomplete)
+}
+
+func TestRedisStoreCountPeersAcrossWindows(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	clk := clock.NewMock()
+	// Start from the current time so EXPIREAT does not expire keys immediately.
+	clk.Set(time.Now())
+
+	s, err := NewRedisStore(config, clk)
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+
+	stale := core.PeerInfoFixture()
+	completing := core.PeerInfoFixture()
+	leecher := core.PeerInfoFixture()
+
+	require.NoError(s.UpdatePeer(context.Background(), h, stale))
+	require.NoError(s.UpdatePeer(context.Background(), h, completing))
+	require.NoError(s.UpdatePeer(context.Background(), h, leecher))
+
+	clk.Add(config.PeerSetWindowSize)
+
+	// The stale peer has not announced in the new window, and the completing
+	// peer announces again as a seeder.
+	completing.Complete = true
+	require.NoError(s.UpdatePeer(context.Background(), h, completing))
+	require.NoError(s.UpdatePeer(context.Background(), h, leecher))
+
+	complete, incomplete, err := s.CountPeers(context.Background(), h)
+	require.NoError(err)
+	require.Equal(1, complete)
+	require.Equal(2, incomplete)
+
+	// Peers which have not announced within any of the windows are not counted.
+	clk.Add(time.Duration(config.MaxPeerSetWindows) * config.PeerSetWindowSize)
+
+	complete, incomplete, err = s.CountPeers(context.Background(), h)
+	require.NoError(err)
+	require.Equal(0, complete)
+	require.Equal(0, incomplete)
+}
+
 func TestRedisStorePeerExpiration(t *testing.T) {
 	require := require.New(t)
 
@@ -167,15 +260,57 @@ func TestRedisStorePeerExpiration(t *testing.T) {
 	h := core.InfoHashFixture()
 	p := core.PeerInfoFixture()
 
-	require.NoError(s.UpdatePeer(h, p))
+	require.NoError(s.UpdatePeer(context.Background(), h, p))
 
-	result, err := s.GetPeers(h, 1)
+	result, err := s.GetPeers(context.Background(), h, 1)
 	require.NoError(err)
 	require.Len(result, 1)
 
 	time.Sleep(3 * time.Second)
 
-	result, err = s.GetPeers(h, 1)
+	result, err = s.GetPeers(context.Background(), h, 1)
 	require.NoError(err)
 	require.Empty(result)
 }
+
+func TestRedisStoreCanceledContext(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	h := core.InfoHashFixture()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.Equal(context.Canceled, s.UpdatePeer(ctx, h, core.PeerInfoFixture()))
+
+	_, err = s.GetPeers(ctx, h, 1)
+	require.Equal(context.Canceled, err)
+}
+
+func TestRedisStoreContextCanceledWhileWaitingForConn(t *testing.T) {
+	require := require.New(t)
+
+	config := redisConfigFixture()
+	config.MaxActiveConns = 1
+
+	s, err := NewRedisStore(config, clock.New())
+	require.NoError(err)
+
+	// Exhaust the pool so the next call must wait for a connection.
+	c := s.pool.Get()
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err = s.GetPeers(ctx, core.InfoHashFixture(), 1)
+	require.Equal(context.Canceled, err)
+}
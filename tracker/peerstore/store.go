@@ -14,15 +14,22 @@
 package peerstore
 
 import (
+	"context"
+
 	"github.com/uber/kraken/core"
 )
 
-// Store provides storage for announcing peers.
+// Store provides storage for announcing peers. All methods abort with ctx.Err()
+// if ctx is done before the operation completes.
 type Store interface {
 
 	// GetPeers returns at most n random peers announcing for h.
-	GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error)
+	GetPeers(ctx context.Context, h core.InfoHash, n int) ([]*core.PeerInfo, error)
+
+	// CountPeers returns the number of complete and incomplete peers
+	// announcing for h.
+	CountPeers(ctx context.Context, h core.InfoHash) (complete, incomplete int, err error)
 
 	// UpdatePeer updates peer fields.
-	UpdatePeer(h core.InfoHash, peer *core.PeerInfo) error
+	UpdatePeer(ctx context.Context, h core.InfoHash, peer *core.PeerInfo) error
 }
@@ -14,6 +14,7 @@
 package peerstore
 
 import (
+	"context"
 	"errors"
 	"sync"
 
@@ -32,7 +33,7 @@ func NewTestStore() Store {
 	}
 }
 
-func (s *testStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
+func (s *testStore) UpdatePeer(ctx context.Context, h core.InfoHash, p *core.PeerInfo) error {
 	s.Lock()
 	defer s.Unlock()
 
@@ -51,7 +52,7 @@ func (s *testStore) UpdatePeer(h core.InfoHash, p *core.PeerInfo) error {
 	return nil
 }
 
-func (s *testStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
+func (s *testStore) GetPeers(ctx context.Context, h core.InfoHash, n int) ([]*core.PeerInfo, error) {
 	s.Lock()
 	defer s.Unlock()
 
@@ -66,3 +67,19 @@ func (s *testStore) GetPeers(h core.InfoHash, n int) ([]*core.PeerInfo, error) {
 	}
 	return copies, nil
 }
+
+func (s *testStore) CountPeers(
+	ctx context.Context, h core.InfoHash) (complete, incomplete int, err error) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	for _, p := range s.torrents[h] {
+		if p.Complete {
+			complete++
+		} else {
+			incomplete++
+		}
+	}
+	return complete, incomplete, nil
+}
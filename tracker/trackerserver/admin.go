@@ -0,0 +1,60 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/log"
+)
+
+// logLevelResponse reports the level of the global logger.
+type logLevelResponse struct {
+	Level string `json:"level"`
+}
+
+func (s *Server) getLogLevelHandler(w http.ResponseWriter, r *http.Request) error {
+	return writeLogLevel(w)
+}
+
+// setLogLevelHandler changes the level of the global logger to the level query
+// argument, e.g. PUT /admin/log-level?level=warn.
+func (s *Server) setLogLevelHandler(w http.ResponseWriter, r *http.Request) error {
+	var level zapcore.Level
+	switch v := r.URL.Query().Get("level"); v {
+	case "debug", "info", "warn", "error":
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return handler.Errorf("parse level: %s", err).Status(http.StatusBadRequest)
+		}
+	case "":
+		return handler.Errorf("missing level").Status(http.StatusBadRequest)
+	default:
+		return handler.Errorf(
+			"invalid level %q: must be one of debug, info, warn, error", v).Status(http.StatusBadRequest)
+	}
+	log.SetLevel(level)
+	return writeLogLevel(w)
+}
+
+func writeLogLevel(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&logLevelResponse{log.GetLevel().String()}); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
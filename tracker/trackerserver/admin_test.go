@@ -0,0 +1,149 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/log"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestLogLevelEndpoint(t *testing.T) {
+	require := require.New(t)
+
+	// Capture the output of the global logger.
+	f, err := ioutil.TempFile("", "trackerserver-log")
+	require.NoError(err)
+	defer os.Remove(f.Name())
+	require.NoError(f.Close())
+
+	// Restore the original logger and its level for later tests.
+	prevLevel := log.GetLevel()
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Encoding = "console"
+	zapConfig.OutputPaths = []string{f.Name()}
+	restore := log.ReplaceLogger(zapConfig)
+	defer func() {
+		restore()
+		log.SetLevel(prevLevel)
+	}()
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	adminAddr, adminStop := testutil.StartServer(mocks.server().AdminHandler())
+	defer adminStop()
+
+	url := fmt.Sprintf("http://%s/admin/log-level", adminAddr)
+
+	setLevel := func(level string) {
+		_, err := httputil.Put(fmt.Sprintf("%s?level=%s", url, level))
+		require.NoError(err)
+	}
+	getLevel := func() string {
+		resp, err := httputil.Get(url)
+		require.NoError(err)
+		defer resp.Body.Close()
+		var body logLevelResponse
+		require.NoError(json.NewDecoder(resp.Body).Decode(&body))
+		return body.Level
+	}
+	// announce logs the handout at debug level and returns all output logged
+	// so far.
+	announce := func() string {
+		blob := core.NewBlobFixture()
+		mocks.peerStore.EXPECT().UpdatePeer(
+			gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(nil)
+		mocks.peerStore.EXPECT().GetPeers(
+			gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(
+			[]*core.PeerInfo{core.PeerInfoFixture()}, nil)
+		mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+		_, err := sendAnnounce(addr, &announceclient.Request{
+			Digest:   &blob.Digest,
+			InfoHash: blob.MetaInfo.InfoHash(),
+			Peer:     core.PeerInfoFixture(),
+		})
+		require.NoError(err)
+
+		b, err := ioutil.ReadFile(f.Name())
+		require.NoError(err)
+		return string(b)
+	}
+
+	setLevel("warn")
+	require.Equal("warn", getLevel())
+	require.NotContains(announce(), "Handing out")
+
+	setLevel("debug")
+	require.Equal("debug", getLevel())
+	require.Contains(announce(), "Handing out")
+}
+
+func TestLogLevelEndpointRestoresLogger(t *testing.T) {
+	require := require.New(t)
+
+	prev := log.Default()
+	prevLevel := log.GetLevel()
+
+	restore := log.ReplaceLogger(zap.NewDevelopmentConfig())
+	require.NotEqual(prev, log.Default())
+	log.SetLevel(zap.ErrorLevel)
+	restore()
+
+	require.Equal(prev, log.Default())
+	require.Equal(prevLevel, log.GetLevel())
+}
+
+func TestLogLevelEndpointBadRequest(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.server().AdminHandler())
+	defer stop()
+
+	for _, query := range []string{"", "?level=", "?level=fatal", "?level=bogus"} {
+		t.Run(query, func(t *testing.T) {
+			_, err := httputil.Put(fmt.Sprintf("http://%s/admin/log-level%s", addr, query))
+			require.True(t, httputil.IsStatus(err, http.StatusBadRequest))
+		})
+	}
+}
+
+func TestLogLevelEndpointNotServedPublicly(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	_, err := httputil.Put(fmt.Sprintf("http://%s/admin/log-level?level=debug", addr))
+	require.True(t, httputil.IsStatus(err, http.StatusNotFound))
+}
@@ -4,7 +4,7 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//     http://www.apache.org/licenses/LICENSE-2.0
+//	http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
@@ -14,35 +14,52 @@
 package trackerserver
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/uber-go/tally"
 
 	"github.com/uber/kraken/core"
 	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/tracker/peerhandoutpolicy"
 	"github.com/uber/kraken/utils/errutil"
 	"github.com/uber/kraken/utils/handler"
 	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/log"
 )
 
+// _fractionBuckets buckets ratios in [0, 1] by tenths.
+var _fractionBuckets = tally.MustMakeLinearValueBuckets(0, 0.1, 11)
+
+// _handoutSizeBuckets buckets peer handout sizes by powers of two.
+var _handoutSizeBuckets = append(
+	tally.ValueBuckets{0}, tally.MustMakeExponentialValueBuckets(1, 2, 12)...)
+
 func (s *Server) announceHandlerV1(w http.ResponseWriter, r *http.Request) error {
-	req := new(announceclient.Request)
-	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-		return handler.Errorf("json decode request: %s", err)
-	}
-	d, err := req.GetDigest()
+	req, err := decodeAnnounceRequest(r.Body)
 	if err != nil {
-		return handler.Errorf("get request digest: %s", err)
+		return err
 	}
-	resp, err := s.announce(d, req.InfoHash, req.Peer)
+	s.resolvePeerIP(r, req.Peer)
+	d, err := validateAnnounceRequest(req)
 	if err != nil {
 		return err
 	}
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
-		return handler.Errorf("json encode response: %s", err)
+	resp, err := s.announce(r.Context(), d, req.InfoHash, req.Peer, req.NumWant)
+	if err != nil {
+		return err
 	}
-	return nil
+	// The info hash is in the body, so the URL cannot key a shared cache.
+	return s.writeAnnounceResponse(w, r, resp, false)
 }
 
 func (s *Server) announceHandlerV2(w http.ResponseWriter, r *http.Request) error {
@@ -54,53 +71,320 @@ func (s *Server) announceHandlerV2(w http.ResponseWriter, r *http.Request) error
 	if err != nil {
 		return fmt.Errorf("parse infohash: %s", err)
 	}
-	req := new(announceclient.Request)
-	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-		return handler.Errorf("json decode request: %s", err)
+	req, err := decodeAnnounceRequest(r.Body)
+	if err != nil {
+		return err
 	}
-	d, err := req.GetDigest()
+	s.resolvePeerIP(r, req.Peer)
+	d, err := validateAnnounceRequest(req)
 	if err != nil {
-		return handler.Errorf("get request digest: %s", err)
+		return err
 	}
-	resp, err := s.announce(d, h, req.Peer)
+	resp, err := s.announce(r.Context(), d, h, req.Peer, req.NumWant)
 	if err != nil {
 		return err
 	}
-	if err := json.NewEncoder(w).Encode(resp); err != nil {
+	return s.writeAnnounceResponse(w, r, resp, true)
+}
+
+// bulkAnnounceResult is the outcome of a single announce within a bulk announce.
+type bulkAnnounceResult struct {
+	Response *announceclient.Response `json:"response,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+// bulkAnnounceHandler announces a list of requests in parallel, such that
+// seeders may register many torrents in a single round trip. Each request is
+// handled independently and reports its own error.
+func (s *Server) bulkAnnounceHandler(w http.ResponseWriter, r *http.Request) error {
+	var reqs []*announceclient.Request
+	if err := json.NewDecoder(r.Body).Decode(&reqs); err != nil {
+		return handler.Errorf("json decode request: %s", err).Status(http.StatusBadRequest)
+	}
+	if len(reqs) > s.config.MaxBulkAnnounceSize {
+		return handler.Errorf(
+			"bulk announce of %d exceeds limit of %d", len(reqs), s.config.MaxBulkAnnounceSize).
+			Status(http.StatusBadRequest)
+	}
+	results := make([]bulkAnnounceResult, len(reqs))
+	sem := make(chan struct{}, s.config.BulkAnnounceConcurrency)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req *announceclient.Request) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if req != nil {
+				s.resolvePeerIP(r, req.Peer)
+			}
+			resp, err := s.announceRequest(r.Context(), req)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			s.recordHandout(resp.Peers)
+			results[i].Response = resp
+		}(i, req)
+	}
+	wg.Wait()
+
+	w.WriteHeader(http.StatusMultiStatus)
+	if err := json.NewEncoder(w).Encode(results); err != nil {
 		return handler.Errorf("json encode response: %s", err)
 	}
 	return nil
 }
 
+// resolvePeerIP defaults the ip of peer to the source ip of r if the client
+// did not send one, and canonicalizes it such that the same peer is always
+// stored under the same address.
+func (s *Server) resolvePeerIP(r *http.Request, peer *core.PeerInfo) {
+	if peer == nil {
+		return
+	}
+	if peer.IP == "" {
+		peer.IP = s.sourceIP(r)
+	}
+	if ip := net.ParseIP(peer.IP); ip != nil {
+		peer.IP = ip.String()
+	}
+}
+
+func (s *Server) announceRequest(
+	ctx context.Context, req *announceclient.Request) (*announceclient.Response, error) {
+
+	if req == nil {
+		return nil, errors.New("missing request")
+	}
+	d, err := validateAnnounceRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return s.announce(ctx, d, req.InfoHash, req.Peer, req.NumWant)
+}
+
 func (s *Server) announce(
-	d core.Digest, h core.InfoHash, peer *core.PeerInfo) (*announceclient.Response, error) {
+	ctx context.Context,
+	d core.Digest,
+	h core.InfoHash,
+	peer *core.PeerInfo,
+	numWant *int) (*announceclient.Response, error) {
 
-	if err := s.peerStore.UpdatePeer(h, peer); err != nil {
+	if s.config.AnnounceTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.AnnounceTimeout)
+		defer cancel()
+	}
+	timer := s.stats.Timer("update_peer").Start()
+	err := s.peerStore.UpdatePeer(ctx, h, peer)
+	timer.Stop()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, deadlineExceeded(fmt.Errorf("update peer: %s", err))
+		}
 		log.With(
 			"hash", h,
 			"peer_id", peer.PeerID).Errorf("Error updating peer: %s", err)
 	}
-	peers, err := s.getPeerHandout(d, h, peer)
+	peers, err := s.getPeerHandout(ctx, s.stats, s.policy, d, h, peer, numWant)
 	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, deadlineExceeded(err)
+		}
 		return nil, err
 	}
+	log.With(
+		"hash", h,
+		"peer_id", peer.PeerID).Debugf("Handing out %d peers", len(peers))
 	return &announceclient.Response{
-		Peers:    peers,
-		Interval: s.config.AnnounceInterval,
+		Peers:       peers,
+		Interval:    s.config.AnnounceInterval,
+		MinInterval: s.config.MinAnnounceInterval,
+		Fingerprint: peerFingerprint(peers),
 	}, nil
 }
 
+// deadlineExceeded returns a retryable error for a request which ran out of
+// time.
+func deadlineExceeded(err error) error {
+	return handler.Errorf("deadline exceeded: %s", err).Status(http.StatusServiceUnavailable)
+}
+
+// peerFingerprint returns a digest of the peer ids in peers, independent of
+// their order. Returns empty string if there are no peers.
+func peerFingerprint(peers []*core.PeerInfo) string {
+	if len(peers) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, p := range core.SortedByPeerID(peers) {
+		h.Write(p.PeerID[:])
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// writeAnnounceResponse writes resp to w. Responses may only be marked
+// cacheable if the request URL identifies the torrent.
+func (s *Server) writeAnnounceResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	resp *announceclient.Response,
+	cacheable bool) error {
+
+	b, resp, err := s.encodeAnnounceResponse(resp)
+	if err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	s.recordHandout(resp.Peers)
+	s.setAnnounceCacheHeaders(w, cacheable)
+	if resp.Fingerprint != "" {
+		w.Header().Set("ETag", strconv.Quote(resp.Fingerprint))
+		if strings.Trim(r.Header.Get("If-None-Match"), `"`) == resp.Fingerprint {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+	w.Write(b)
+	return nil
+}
+
+// recordHandout records metrics on the peers actually handed out.
+func (s *Server) recordHandout(peers []*core.PeerInfo) {
+	stats := s.stats.Tagged(map[string]string{
+		"policy_name": s.policy.Name(),
+	})
+	stats.Histogram("peer_handout_size", _handoutSizeBuckets).RecordValue(float64(len(peers)))
+	if len(peers) == 0 {
+		return
+	}
+	var seeders int
+	for _, p := range peers {
+		if p.Complete {
+			seeders++
+		}
+	}
+	stats.Histogram("seeder_fraction", _fractionBuckets).RecordValue(
+		float64(seeders) / float64(len(peers)))
+}
+
+// encodeAnnounceResponse serializes resp, dropping the lowest priority peers
+// until the encoding fits within the configured response size budget. Origins
+// are never dropped. Returns the encoded response, which is flagged as
+// truncated and fingerprinted over the remaining peers if any were dropped.
+func (s *Server) encodeAnnounceResponse(
+	resp *announceclient.Response) ([]byte, *announceclient.Response, error) {
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	budget := s.config.MaxAnnounceResponseBytes
+	if budget <= 0 || len(b) <= budget {
+		return b, resp, nil
+	}
+	var droppable int
+	for _, p := range resp.Peers {
+		if !p.Origin {
+			droppable++
+		}
+	}
+	truncated := *resp
+	truncated.Truncated = true
+	encode := func(n int) ([]byte, error) {
+		truncated.Peers = keepPeers(resp.Peers, n)
+		truncated.Fingerprint = peerFingerprint(truncated.Peers)
+		return json.Marshal(&truncated)
+	}
+	// Binary search for the largest number of non-origin peers which fits the
+	// budget.
+	lo, hi := 0, droppable-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		b, err := encode(mid)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(b) <= budget {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	b, err = encode(lo)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.stats.Counter("announce_response_truncated").Inc(1)
+	if len(b) > budget {
+		// Origins alone exceed the budget. Serve them anyway, since the peer
+		// cannot download without them.
+		s.stats.Counter("announce_response_over_budget").Inc(1)
+	}
+	return b, &truncated, nil
+}
+
+// keepPeers returns peers with all origins and only the first n other peers,
+// preserving order.
+func keepPeers(peers []*core.PeerInfo, n int) []*core.PeerInfo {
+	var kept []*core.PeerInfo
+	for _, p := range peers {
+		if p.Origin {
+			kept = append(kept, p)
+		} else if n > 0 {
+			kept = append(kept, p)
+			n--
+		}
+	}
+	return kept
+}
+
+// setAnnounceCacheHeaders marks announce responses as privately cacheable for
+// the announce interval if configured and allowed, else forbids caching
+// entirely.
+func (s *Server) setAnnounceCacheHeaders(w http.ResponseWriter, cacheable bool) {
+	if !s.config.CacheAnnounceResponses || !cacheable {
+		w.Header().Set("Cache-Control", "no-store")
+		return
+	}
+	// The handout depends on the requester, e.g. seeders receive no peers and
+	// the source peer is excluded, so only the requester's own cache may store
+	// it. Expires is omitted since HTTP/1.0 caches ignore private.
+	maxAge := int(s.config.AnnounceInterval.Seconds())
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+}
+
+// getPeerHandout builds the handout for peer, recording storage latencies to
+// stats.
 func (s *Server) getPeerHandout(
-	d core.Digest, h core.InfoHash, peer *core.PeerInfo) ([]*core.PeerInfo, error) {
+	ctx context.Context,
+	stats tally.Scope,
+	policy *peerhandoutpolicy.PriorityPolicy,
+	d core.Digest,
+	h core.InfoHash,
+	peer *core.PeerInfo,
+	numWant *int) ([]*core.PeerInfo, error) {
 
 	if peer.Complete {
 		// If the peer is announcing as complete, don't return a peer handout since
 		// the peer does not need it.
 		return nil, nil
 	}
+	if numWant != nil && *numWant == 0 {
+		return nil, nil
+	}
 	var errs []error
-	peers, err := s.peerStore.GetPeers(h, s.config.PeerHandoutLimit)
+	timer := stats.Timer("get_peers").Start()
+	peers, err := s.peerStore.GetPeers(ctx, h, s.peerHandoutLimit(numWant))
+	timer.Stop()
 	if err != nil {
+		// Origins alone would hand out an unrepresentative swarm, so let the
+		// client retry rather than settle for them.
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, deadlineExceeded(fmt.Errorf("get peers: %s", err))
+		}
 		errs = append(errs, fmt.Errorf("peer store: %s", err))
 	}
 	origins, err := s.originStore.GetOrigins(d)
@@ -108,8 +392,82 @@ func (s *Server) getPeerHandout(
 		errs = append(errs, fmt.Errorf("origin store: %s", err))
 	}
 	peers = append(peers, origins...)
+	peers = filterReachablePeers(peer, peers)
 	if len(peers) == 0 {
 		return nil, handler.Errorf("no peers available: %s", errutil.Join(errs))
 	}
-	return s.policy.SortPeers(peer, peers), nil
+	// A swarm of just the source is not an error, it yields an empty handout.
+	peers = excludeSource(peer, peers)
+	peers = policy.SortPeers(peer, peers)
+	if numWant != nil && *numWant > 0 {
+		peers = capHandout(peers, s.peerHandoutLimit(numWant))
+	}
+	return peers, nil
+}
+
+// capHandout truncates the sorted peers to n, keeping at least one origin if
+// there are any, since origins are the only guaranteed source of the blob.
+func capHandout(peers []*core.PeerInfo, n int) []*core.PeerInfo {
+	if len(peers) <= n {
+		return peers
+	}
+	kept := append([]*core.PeerInfo(nil), peers[:n]...)
+	for _, p := range kept {
+		if p.Origin {
+			return kept
+		}
+	}
+	for _, p := range peers[n:] {
+		if p.Origin {
+			kept[n-1] = p
+			break
+		}
+	}
+	return kept
+}
+
+// filterReachablePeers drops IPv6 peers from the handout of IPv4 peers, which
+// cannot connect to them. Peers addressed by hostname are always kept.
+func filterReachablePeers(source *core.PeerInfo, peers []*core.PeerInfo) []*core.PeerInfo {
+	if ip := net.ParseIP(source.IP); ip == nil || ip.To4() == nil {
+		return peers
+	}
+	var reachable []*core.PeerInfo
+	for _, p := range peers {
+		if !isIPv6(p.IP) {
+			reachable = append(reachable, p)
+		}
+	}
+	return reachable
+}
+
+// excludeSource removes source from peers, whether it is identified by peer id
+// or by address.
+func excludeSource(source *core.PeerInfo, peers []*core.PeerInfo) []*core.PeerInfo {
+	var others []*core.PeerInfo
+	for _, p := range peers {
+		if source.PeerID != (core.PeerID{}) && p.PeerID == source.PeerID {
+			continue
+		}
+		if p.IP == source.IP && p.Port == source.Port {
+			continue
+		}
+		others = append(others, p)
+	}
+	return others
+}
+
+func isIPv6(s string) bool {
+	ip := net.ParseIP(s)
+	return ip != nil && ip.To4() == nil
+}
+
+// peerHandoutLimit resolves the number of peers requested by the client
+// against the configured handout limit. Falls back to the configured limit if
+// the client did not request a valid number of peers.
+func (s *Server) peerHandoutLimit(numWant *int) int {
+	if numWant == nil || *numWant <= 0 || *numWant > s.config.PeerHandoutLimit {
+		return s.config.PeerHandoutLimit
+	}
+	return *numWant
 }
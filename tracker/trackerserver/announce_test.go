@@ -14,8 +14,15 @@
 package trackerserver
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
 	"time"
 
@@ -23,10 +30,12 @@ import (
 	"github.com/uber/kraken/lib/hashring"
 	"github.com/uber/kraken/lib/hostlist"
 	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/httputil"
 	"github.com/uber/kraken/utils/testutil"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
 )
 
 func newAnnounceClient(pctx core.PeerContext, addr string) announceclient.Client {
@@ -55,9 +64,9 @@ func TestAnnounceSinglePeerResponse(t *testing.T) {
 
 			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
 			mocks.peerStore.EXPECT().GetPeers(
-				blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+				gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
 			mocks.peerStore.EXPECT().UpdatePeer(
-				blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+				gomock.Any(), blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
 
 			result, interval, err := client.Announce(
 				blob.Digest, blob.MetaInfo.InfoHash(), false, version)
@@ -86,9 +95,9 @@ func TestAnnounceUnavailablePeerStoreCanStillProvideOrigins(t *testing.T) {
 	storeErr := errors.New("some storage error")
 
 	mocks.peerStore.EXPECT().UpdatePeer(
-		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(storeErr)
+		gomock.Any(), blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(storeErr)
 	mocks.peerStore.EXPECT().GetPeers(
-		blob.MetaInfo.InfoHash(), gomock.Any()).Return(nil, storeErr)
+		gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(nil, storeErr)
 	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
 
 	result, _, err := client.Announce(
@@ -114,9 +123,9 @@ func TestAnnouceUnavailableOriginClusterCanStillProvidePeers(t *testing.T) {
 	peers := []*core.PeerInfo{core.PeerInfoFixture()}
 
 	mocks.peerStore.EXPECT().UpdatePeer(
-		blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
+		gomock.Any(), blob.MetaInfo.InfoHash(), core.PeerInfoFromContext(pctx, false)).Return(nil)
 	mocks.peerStore.EXPECT().GetPeers(
-		blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+		gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
 	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, errors.New("some error"))
 
 	result, _, err := client.Announce(
@@ -125,6 +134,463 @@ func TestAnnouceUnavailableOriginClusterCanStillProvidePeers(t *testing.T) {
 	require.Equal(peers, result)
 }
 
+func TestAnnounceV1NeverCacheable(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		AnnounceInterval:       5 * time.Second,
+		CacheAnnounceResponses: true,
+	}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	peer := core.PeerInfoFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		gomock.Any(), blob.MetaInfo.InfoHash(), peer).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(
+		[]*core.PeerInfo{core.PeerInfoFixture()}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	body, err := json.Marshal(&announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: blob.MetaInfo.InfoHash(),
+		Peer:     peer,
+	})
+	require.NoError(err)
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/announce", addr), httputil.SendBody(bytes.NewReader(body)))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	require.Equal("no-store", resp.Header.Get("Cache-Control"))
+	require.Empty(resp.Header.Get("Expires"))
+}
+
+func TestAnnounceTimeout(t *testing.T) {
+	// Simulates a peer store which only returns once the request is abandoned.
+	slowUpdate := func(ctx context.Context, h core.InfoHash, p *core.PeerInfo) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	slowGet := func(ctx context.Context, h core.InfoHash, n int) ([]*core.PeerInfo, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	tests := []struct {
+		description string
+		setup       func(mocks *serverMocks, h core.InfoHash)
+	}{
+		{"update peer", func(mocks *serverMocks, h core.InfoHash) {
+			mocks.peerStore.EXPECT().UpdatePeer(
+				gomock.Any(), h, gomock.Any()).DoAndReturn(slowUpdate)
+		}},
+		{"get peers", func(mocks *serverMocks, h core.InfoHash) {
+			mocks.peerStore.EXPECT().UpdatePeer(gomock.Any(), h, gomock.Any()).Return(nil)
+			mocks.peerStore.EXPECT().GetPeers(
+				gomock.Any(), h, gomock.Any()).DoAndReturn(slowGet)
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			require := require.New(t)
+
+			config := Config{AnnounceTimeout: 200 * time.Millisecond}
+
+			mocks, cleanup := newServerMocks(t, config)
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			pctx := core.PeerContextFixture()
+			blob := core.NewBlobFixture()
+
+			client := newAnnounceClient(pctx, addr)
+
+			test.setup(mocks, blob.MetaInfo.InfoHash())
+
+			// Even though origins are available, the client should retry
+			// rather than settle for them.
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(
+				[]*core.PeerInfo{core.OriginPeerInfoFixture()}, nil).AnyTimes()
+
+			start := time.Now()
+			_, _, err := client.Announce(
+				blob.Digest, blob.MetaInfo.InfoHash(), false, announceclient.V2)
+			require.Error(err)
+			require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+			require.True(time.Since(start) < time.Second)
+		})
+	}
+}
+
+// sendAnnounce posts req to the V2 announce endpoint. Options, e.g. headers,
+// are applied after the request body.
+func sendAnnounce(
+	addr string, req *announceclient.Request, opts ...httputil.SendOption) (*http.Response, error) {
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]httputil.SendOption{httputil.SendBody(bytes.NewReader(body))}, opts...)
+	return httputil.Post(
+		fmt.Sprintf("http://%s/announce/%s", addr, req.InfoHash.String()), opts...)
+}
+
+func TestAnnounceCacheHeaders(t *testing.T) {
+	tests := []struct {
+		desc         string
+		cacheable    bool
+		cacheControl string
+	}{
+		{"disabled", false, "no-store"},
+		{"enabled", true, "private, max-age=5"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			config := Config{
+				AnnounceInterval:       5 * time.Second,
+				CacheAnnounceResponses: test.cacheable,
+			}
+
+			mocks, cleanup := newServerMocks(t, config)
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			peer := core.PeerInfoFixture()
+
+			peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+			mocks.peerStore.EXPECT().UpdatePeer(
+				gomock.Any(), blob.MetaInfo.InfoHash(), peer).Return(nil)
+			mocks.peerStore.EXPECT().GetPeers(
+				gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+			resp, err := sendAnnounce(addr, &announceclient.Request{
+				Digest:   &blob.Digest,
+				InfoHash: blob.MetaInfo.InfoHash(),
+				Peer:     peer,
+			})
+			require.NoError(err)
+			defer resp.Body.Close()
+
+			require.Equal(test.cacheControl, resp.Header.Get("Cache-Control"))
+			require.Empty(resp.Header.Get("Expires"))
+		})
+	}
+}
+
+func TestAnnounceCachedHandoutIsPrivateToRequester(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{
+		AnnounceInterval:       5 * time.Second,
+		CacheAnnounceResponses: true,
+	}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	seeder := core.PeerInfoFixture()
+	seeder.Complete = true
+	leecher := core.PeerInfoFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(gomock.Any(), h, seeder).Return(nil)
+	mocks.peerStore.EXPECT().UpdatePeer(gomock.Any(), h, leecher).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(gomock.Any(), h, gomock.Any()).Return(
+		[]*core.PeerInfo{core.PeerInfoFixture()}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	// Both requesters announce to the same URL, but receive different handouts.
+	announce := func(peer *core.PeerInfo) (*http.Response, announceclient.Response) {
+		resp, err := sendAnnounce(addr, &announceclient.Request{
+			Digest:   &blob.Digest,
+			InfoHash: h,
+			Peer:     peer,
+		})
+		require.NoError(err)
+		defer resp.Body.Close()
+		var result announceclient.Response
+		require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+		return resp, result
+	}
+	seederResp, seederResult := announce(seeder)
+	leecherResp, leecherResult := announce(leecher)
+
+	require.Empty(seederResult.Peers)
+	require.Len(leecherResult.Peers, 1)
+	require.Equal(seederResp.Request.URL.String(), leecherResp.Request.URL.String())
+
+	// Hence no shared cache may serve one requester's handout to the other.
+	for _, resp := range []*http.Response{seederResp, leecherResp} {
+		cc := resp.Header.Get("Cache-Control")
+		require.Contains(cc, "private")
+		require.NotContains(cc, "public")
+		require.Empty(resp.Header.Get("Expires"))
+	}
+}
+
+func TestAnnounceResponseSizeBudget(t *testing.T) {
+	const budget = 1024
+
+	for _, n := range []int{0, 1, 5, 50, 200} {
+		t.Run(fmt.Sprintf("%d peers", n), func(t *testing.T) {
+			require := require.New(t)
+
+			config := Config{MaxAnnounceResponseBytes: budget}
+
+			mocks, cleanup := newServerMocks(t, config)
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			peer := core.PeerInfoFixture()
+
+			var peers []*core.PeerInfo
+			for i := 0; i < n; i++ {
+				// Fixed width ids and addresses such that every peer encodes to
+				// the same size, else the truncation check below is order
+				// dependent. Peer ids encode as arrays of decimal bytes.
+				var id core.PeerID
+				for j := range id {
+					id[j] = 100
+				}
+				id[0], id[1] = byte(100+i%100), byte(100+i/100)
+				peers = append(peers, core.NewPeerInfo(id, "10.0.0.1", 8000, false, false))
+			}
+			origins := []*core.PeerInfo{core.OriginPeerInfoFixture()}
+
+			mocks.peerStore.EXPECT().UpdatePeer(
+				gomock.Any(), blob.MetaInfo.InfoHash(), peer).Return(nil)
+			mocks.peerStore.EXPECT().GetPeers(
+				gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
+
+			resp, err := sendAnnounce(addr, &announceclient.Request{
+				Digest:   &blob.Digest,
+				InfoHash: blob.MetaInfo.InfoHash(),
+				Peer:     peer,
+			})
+			require.NoError(err)
+			defer resp.Body.Close()
+
+			b, err := ioutil.ReadAll(resp.Body)
+			require.NoError(err)
+			require.True(len(b) <= budget, "response is %d bytes", len(b))
+
+			var result announceclient.Response
+			require.NoError(json.Unmarshal(b, &result))
+			require.NotEmpty(result.Peers)
+			require.True(len(result.Peers) <= n+1)
+			require.Equal(len(result.Peers) < n+1, result.Truncated)
+			require.Contains(result.Peers, origins[0])
+
+			// The fingerprint covers exactly the peers which were sent.
+			require.Equal(peerFingerprint(result.Peers), result.Fingerprint)
+			require.Equal(strconv.Quote(result.Fingerprint), resp.Header.Get("ETag"))
+
+			if result.Truncated {
+				// Adding the next peer must have exceeded the budget.
+				result.Peers = append(result.Peers, peers[0])
+				b, err := json.Marshal(&result)
+				require.NoError(err)
+				require.True(len(b) > budget)
+			}
+		})
+	}
+}
+
+func TestAnnounceResponseOverBudgetKeepsOrigins(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{MaxAnnounceResponseBytes: 10})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	peer := core.PeerInfoFixture()
+	origins := []*core.PeerInfo{core.OriginPeerInfoFixture()}
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		gomock.Any(), blob.MetaInfo.InfoHash(), peer).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(
+		[]*core.PeerInfo{core.PeerInfoFixture()}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
+
+	resp, err := sendAnnounce(addr, &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: blob.MetaInfo.InfoHash(),
+		Peer:     peer,
+	})
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var result announceclient.Response
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.True(result.Truncated)
+	require.Equal(origins, result.Peers)
+
+	var overBudget int64
+	for _, c := range mocks.stats.(tally.TestScope).Snapshot().Counters() {
+		if c.Name() == "testing.announce_response_over_budget" {
+			overBudget = c.Value()
+		}
+	}
+	require.Equal(int64(1), overBudget)
+}
+
+func TestAnnounceNotModifiedWhenFingerprintMatches(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	peer := core.PeerInfoFixture()
+	req := &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: h,
+		Peer:     peer,
+	}
+	peers := []*core.PeerInfo{core.PeerInfoFixture(), core.PeerInfoFixture()}
+	grown := append([]*core.PeerInfo{core.PeerInfoFixture()}, peers...)
+
+	mocks.peerStore.EXPECT().UpdatePeer(gomock.Any(), h, peer).Return(nil).Times(3)
+	gomock.InOrder(
+		mocks.peerStore.EXPECT().GetPeers(gomock.Any(), h, gomock.Any()).Return(peers, nil),
+		mocks.peerStore.EXPECT().GetPeers(gomock.Any(), h, gomock.Any()).Return(peers, nil),
+		mocks.peerStore.EXPECT().GetPeers(gomock.Any(), h, gomock.Any()).Return(grown, nil))
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil).Times(3)
+
+	announce := func(fingerprint string) (*http.Response, error) {
+		return sendAnnounce(
+			addr, req,
+			httputil.SendHeaders(map[string]string{"If-None-Match": fingerprint}),
+			httputil.SendAcceptedCodes(http.StatusOK, http.StatusNotModified))
+	}
+
+	resp, err := announce("")
+	require.NoError(err)
+	var first announceclient.Response
+	require.NoError(json.NewDecoder(resp.Body).Decode(&first))
+	resp.Body.Close()
+	require.NotEmpty(first.Fingerprint)
+
+	// Unchanged swarm.
+	resp, err = announce(first.Fingerprint)
+	require.NoError(err)
+	resp.Body.Close()
+	require.Equal(http.StatusNotModified, resp.StatusCode)
+
+	// A peer joined.
+	resp, err = announce(first.Fingerprint)
+	require.NoError(err)
+	var third announceclient.Response
+	require.NoError(json.NewDecoder(resp.Body).Decode(&third))
+	resp.Body.Close()
+	require.Equal(http.StatusOK, resp.StatusCode)
+	require.NotEqual(first.Fingerprint, third.Fingerprint)
+	require.Equal(grown, third.Peers)
+}
+
+func TestPeerFingerprintIgnoresOrder(t *testing.T) {
+	require := require.New(t)
+
+	a := core.PeerInfoFixture()
+	b := core.PeerInfoFixture()
+
+	require.Equal(
+		peerFingerprint([]*core.PeerInfo{a, b}),
+		peerFingerprint([]*core.PeerInfo{b, a}))
+	require.NotEqual(
+		peerFingerprint([]*core.PeerInfo{a}),
+		peerFingerprint([]*core.PeerInfo{a, b}))
+	require.Empty(peerFingerprint(nil))
+}
+
+func TestBulkAnnounce(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	var reqs []*announceclient.Request
+	expected := make(map[core.InfoHash][]*core.PeerInfo)
+	for i := 0; i < 20; i++ {
+		blob := core.NewBlobFixture()
+		h := blob.MetaInfo.InfoHash()
+		peer := core.PeerInfoFixture()
+		peers := []*core.PeerInfo{core.PeerInfoFixture()}
+
+		mocks.peerStore.EXPECT().UpdatePeer(gomock.Any(), h, peer).Return(nil)
+		mocks.peerStore.EXPECT().GetPeers(gomock.Any(), h, gomock.Any()).Return(peers, nil)
+		mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+		reqs = append(reqs, &announceclient.Request{
+			Digest:   &blob.Digest,
+			InfoHash: h,
+			Peer:     peer,
+		})
+		expected[h] = peers
+	}
+	// Invalid requests should fail individually.
+	reqs = append(reqs, &announceclient.Request{InfoHash: core.InfoHashFixture()})
+
+	body, err := json.Marshal(reqs)
+	require.NoError(err)
+
+	resp, err := httputil.Post(
+		fmt.Sprintf("http://%s/announce/bulk", addr),
+		httputil.SendBody(bytes.NewReader(body)),
+		httputil.SendAcceptedCodes(http.StatusMultiStatus))
+	require.NoError(err)
+	defer resp.Body.Close()
+	require.Equal(http.StatusMultiStatus, resp.StatusCode)
+
+	var results []bulkAnnounceResult
+	require.NoError(json.NewDecoder(resp.Body).Decode(&results))
+	require.Len(results, len(reqs))
+	for i, req := range reqs[:20] {
+		require.Empty(results[i].Error)
+		require.Equal(expected[req.InfoHash], results[i].Response.Peers)
+	}
+	require.Nil(results[20].Response)
+	require.NotEmpty(results[20].Error)
+}
+
 func TestAnnounceRequestGetDigestBackwardsCompatibility(t *testing.T) {
 	d := core.DigestFixture()
 	h := core.InfoHashFixture()
@@ -168,3 +634,546 @@ func TestAnnounceRequestGetDigestBackwardsCompatibility(t *testing.T) {
 		})
 	}
 }
+
+func TestAnnounceNumWant(t *testing.T) {
+	const limit = 10
+
+	intPtr := func(i int) *int { return &i }
+
+	tests := []struct {
+		desc     string
+		numWant  *int
+		expected int
+	}{
+		{"unset", nil, limit},
+		{"negative", intPtr(-1), limit},
+		{"below limit", intPtr(3), 3},
+		{"at limit", intPtr(limit), limit},
+		{"above limit", intPtr(100), limit},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			config := Config{PeerHandoutLimit: limit}
+
+			mocks, cleanup := newServerMocks(t, config)
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			peer := core.PeerInfoFixture()
+
+			var peers []*core.PeerInfo
+			for i := 0; i < test.expected; i++ {
+				peers = append(peers, core.PeerInfoFixture())
+			}
+			origins := []*core.PeerInfo{core.OriginPeerInfoFixture()}
+
+			mocks.peerStore.EXPECT().UpdatePeer(
+				gomock.Any(), blob.MetaInfo.InfoHash(), peer).Return(nil)
+			mocks.peerStore.EXPECT().GetPeers(
+				gomock.Any(), blob.MetaInfo.InfoHash(), test.expected).Return(peers, nil)
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
+
+			resp, err := sendAnnounce(addr, &announceclient.Request{
+				Digest:   &blob.Digest,
+				InfoHash: blob.MetaInfo.InfoHash(),
+				Peer:     peer,
+				NumWant:  test.numWant,
+			})
+			require.NoError(err)
+			defer resp.Body.Close()
+
+			var result announceclient.Response
+			require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+			if test.numWant != nil && *test.numWant > 0 {
+				// Origins count towards an explicit num_want.
+				require.Len(result.Peers, test.expected)
+			} else {
+				// Origins are handed out in addition to the default limit.
+				require.Len(result.Peers, test.expected+1)
+			}
+			require.Contains(result.Peers, origins[0])
+		})
+	}
+}
+
+func TestAnnounceNonNumericNumWantFallsBack(t *testing.T) {
+	require := require.New(t)
+
+	const limit = 10
+
+	mocks, cleanup := newServerMocks(t, Config{PeerHandoutLimit: limit})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	peer := core.PeerInfoFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		gomock.Any(), blob.MetaInfo.InfoHash(), peer).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		gomock.Any(), blob.MetaInfo.InfoHash(), limit).Return(
+		[]*core.PeerInfo{core.PeerInfoFixture()}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"digest":    blob.Digest,
+		"info_hash": blob.MetaInfo.InfoHash(),
+		"peer":      peer,
+		"num_want":  "lots",
+	})
+	require.NoError(err)
+	resp, err := httputil.Post(
+		fmt.Sprintf("http://%s/announce/%s", addr, blob.MetaInfo.InfoHash().Hex()),
+		httputil.SendBody(bytes.NewReader(body)))
+	require.NoError(err)
+	resp.Body.Close()
+}
+
+func TestAnnounceNumWantKeepsOrigins(t *testing.T) {
+	tests := []struct {
+		desc    string
+		numWant int
+		stored  int
+		origins int
+	}{
+		{"one wanted", 1, 1, 2},
+		{"fewer wanted than available", 3, 3, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t, Config{})
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			peer := core.PeerInfoFixture()
+
+			var stored, origins []*core.PeerInfo
+			for i := 0; i < test.stored; i++ {
+				stored = append(stored, core.PeerInfoFixture())
+			}
+			for i := 0; i < test.origins; i++ {
+				origins = append(origins, core.OriginPeerInfoFixture())
+			}
+
+			numWant := test.numWant
+			mocks.peerStore.EXPECT().UpdatePeer(
+				gomock.Any(), blob.MetaInfo.InfoHash(), peer).Return(nil)
+			mocks.peerStore.EXPECT().GetPeers(
+				gomock.Any(), blob.MetaInfo.InfoHash(), numWant).Return(stored, nil)
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
+
+			resp, err := sendAnnounce(addr, &announceclient.Request{
+				Digest:   &blob.Digest,
+				InfoHash: blob.MetaInfo.InfoHash(),
+				Peer:     peer,
+				NumWant:  &numWant,
+			})
+			require.NoError(err)
+			defer resp.Body.Close()
+
+			var result announceclient.Response
+			require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+
+			// The handout never exceeds num_want, but always has an origin.
+			require.Len(result.Peers, numWant)
+			var hasOrigin bool
+			for _, p := range result.Peers {
+				hasOrigin = hasOrigin || p.Origin
+			}
+			require.True(hasOrigin)
+		})
+	}
+}
+
+func TestAnnounceNumWantZeroReturnsNoPeers(t *testing.T) {
+	require := require.New(t)
+
+	config := Config{AnnounceInterval: 5 * time.Second}
+
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	peer := core.PeerInfoFixture()
+
+	// The peer is still registered, but no handout is read.
+	mocks.peerStore.EXPECT().UpdatePeer(
+		gomock.Any(), blob.MetaInfo.InfoHash(), peer).Return(nil)
+
+	numWant := 0
+	resp, err := sendAnnounce(addr, &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: blob.MetaInfo.InfoHash(),
+		Peer:     peer,
+		NumWant:  &numWant,
+	})
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var result announceclient.Response
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Empty(result.Peers)
+	require.Equal(config.AnnounceInterval, result.Interval)
+}
+
+func TestAnnounceMinInterval(t *testing.T) {
+	tests := []struct {
+		desc     string
+		config   Config
+		expected time.Duration
+	}{
+		{"default", Config{AnnounceInterval: 4 * time.Second}, 2 * time.Second},
+		{"configured", Config{
+			AnnounceInterval:    4 * time.Second,
+			MinAnnounceInterval: time.Second,
+		}, time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t, test.config)
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			peer := core.PeerInfoFixture()
+			peer.Complete = true
+
+			mocks.peerStore.EXPECT().UpdatePeer(
+				gomock.Any(), blob.MetaInfo.InfoHash(), peer).Return(nil)
+
+			resp, err := sendAnnounce(addr, &announceclient.Request{
+				Digest:   &blob.Digest,
+				InfoHash: blob.MetaInfo.InfoHash(),
+				Peer:     peer,
+			})
+			require.NoError(err)
+			defer resp.Body.Close()
+
+			var result announceclient.Response
+			require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+			require.Equal(test.expected, result.MinInterval)
+		})
+	}
+}
+
+func TestResolvePeerIP(t *testing.T) {
+	tests := []struct {
+		desc     string
+		ip       string
+		realIP   string
+		expected string
+	}{
+		{"ipv4", "10.0.0.1", "", "10.0.0.1"},
+		{"ipv6", "2001:DB8::1", "", "2001:db8::1"},
+		{"ipv4 mapped ipv6", "::ffff:10.0.0.1", "", "10.0.0.1"},
+		{"missing uses remote addr", "", "", "192.0.2.1"},
+		{"missing uses real ip header", "", "2001:db8::2", "2001:db8::2"},
+		{"malformed left for validation", "bogus", "", "bogus"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			mocks, cleanup := newServerMocks(t, Config{TrustedProxies: []string{"192.0.2.0/24"}})
+			defer cleanup()
+
+			r := httptest.NewRequest("POST", "/announce", nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			if test.realIP != "" {
+				r.Header.Set("X-Real-IP", test.realIP)
+			}
+			peer := core.PeerInfoFixture()
+			peer.IP = test.ip
+
+			mocks.server().resolvePeerIP(r, peer)
+			require.Equal(t, test.expected, peer.IP)
+		})
+	}
+}
+
+func TestAnnounceDefaultsPeerIPToSource(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	peer := core.PeerInfoFixture()
+	peer.Complete = true
+	peer.IP = ""
+
+	expected := *peer
+	expected.IP = "127.0.0.1"
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		gomock.Any(), blob.MetaInfo.InfoHash(), &expected).Return(nil)
+
+	_, err := sendAnnounce(addr, &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: blob.MetaInfo.InfoHash(),
+		Peer:     peer,
+	})
+	require.NoError(err)
+}
+
+func TestFilterReachablePeers(t *testing.T) {
+	v4 := core.PeerInfoFixture()
+	v4.IP = "10.0.0.1"
+	v6 := core.PeerInfoFixture()
+	v6.IP = "2001:db8::1"
+	host := core.PeerInfoFixture()
+	host.IP = "origin.example.com"
+
+	peers := []*core.PeerInfo{v4, v6, host}
+
+	tests := []struct {
+		desc     string
+		sourceIP string
+		expected []*core.PeerInfo
+	}{
+		{"ipv4 source", "10.0.0.2", []*core.PeerInfo{v4, host}},
+		{"ipv6 source", "2001:db8::2", peers},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			source := core.PeerInfoFixture()
+			source.IP = test.sourceIP
+			require.Equal(t, test.expected, filterReachablePeers(source, peers))
+		})
+	}
+}
+
+func TestAnnounceMetrics(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	peer := core.PeerInfoFixture()
+	peers := []*core.PeerInfo{core.PeerInfoFixture(), core.PeerInfoFixture()}
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		gomock.Any(), blob.MetaInfo.InfoHash(), peer).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	_, err := sendAnnounce(addr, &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: blob.MetaInfo.InfoHash(),
+		Peer:     peer,
+	})
+	require.NoError(err)
+
+	snapshot := mocks.stats.(tally.TestScope).Snapshot()
+
+	timers := make(map[string]int)
+	for _, timer := range snapshot.Timers() {
+		timers[timer.Name()] += len(timer.Values())
+	}
+	require.Equal(1, timers["testing.update_peer"])
+	require.Equal(1, timers["testing.get_peers"])
+
+	require.Equal(
+		map[float64]int64{2: 1}, histogramCounts(snapshot, "testing.peer_handout_size"))
+}
+
+func TestAnnounceMetricsRecordTruncatedHandoutSize(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{MaxAnnounceResponseBytes: 1})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	peers := []*core.PeerInfo{core.PeerInfoFixture(), core.PeerInfoFixture()}
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	resp, err := sendAnnounce(addr, &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: blob.MetaInfo.InfoHash(),
+		Peer:     core.PeerInfoFixture(),
+	})
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var result announceclient.Response
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Empty(result.Peers)
+
+	// The histogram reflects what was sent, not what the store returned.
+	snapshot := mocks.stats.(tally.TestScope).Snapshot()
+	require.Equal(
+		map[float64]int64{0: 1}, histogramCounts(snapshot, "testing.peer_handout_size"))
+}
+
+func TestAnnounceSeederFractionMetric(t *testing.T) {
+	tests := []struct {
+		description string
+		seeders     int
+		leechers    int
+		origins     int
+		bucket      float64
+	}{
+		// Origins are complete, so they count as seeders.
+		{"mixed", 1, 1, 1, 0.7},
+		{"seeders dominate", 4, 1, 1, 0.9},
+		{"leechers dominate", 0, 5, 1, 0.2},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t, Config{})
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+			var peers []*core.PeerInfo
+			for i := 0; i < test.seeders+test.leechers; i++ {
+				p := core.PeerInfoFixture()
+				p.Complete = i < test.seeders
+				peers = append(peers, p)
+			}
+			var origins []*core.PeerInfo
+			for i := 0; i < test.origins; i++ {
+				origins = append(origins, core.OriginPeerInfoFixture())
+			}
+
+			mocks.peerStore.EXPECT().UpdatePeer(
+				gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(nil)
+			mocks.peerStore.EXPECT().GetPeers(
+				gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(peers, nil)
+			mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(origins, nil)
+
+			_, err := sendAnnounce(addr, &announceclient.Request{
+				Digest:   &blob.Digest,
+				InfoHash: blob.MetaInfo.InfoHash(),
+				Peer:     core.PeerInfoFixture(),
+			})
+			require.NoError(err)
+
+			snapshot := mocks.stats.(tally.TestScope).Snapshot()
+			counts := histogramCounts(snapshot, "testing.seeder_fraction")
+			require.Len(counts, 1)
+			for bucket, n := range counts {
+				require.InDelta(test.bucket, bucket, 1e-9)
+				require.Equal(int64(1), n)
+			}
+		})
+	}
+}
+
+func TestAnnounceHandoutMetricsTaggedWithPolicyName(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(
+		[]*core.PeerInfo{core.PeerInfoFixture()}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	_, err := sendAnnounce(addr, &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: blob.MetaInfo.InfoHash(),
+		Peer:     core.PeerInfoFixture(),
+	})
+	require.NoError(err)
+
+	tags := make(map[string]map[string]string)
+	for _, h := range mocks.stats.(tally.TestScope).Snapshot().Histograms() {
+		tags[h.Name()] = h.Tags()
+	}
+	for _, name := range []string{"testing.peer_handout_size", "testing.seeder_fraction"} {
+		require.Contains(tags, name)
+		require.Equal(mocks.policy.Name(), tags[name]["policy_name"])
+	}
+}
+
+// histogramCounts returns the non-empty buckets of the named histogram in
+// snapshot, keyed by bucket upper bound.
+func histogramCounts(snapshot tally.Snapshot, name string) map[float64]int64 {
+	counts := make(map[float64]int64)
+	for _, h := range snapshot.Histograms() {
+		if h.Name() != name {
+			continue
+		}
+		for upper, n := range h.Values() {
+			if n > 0 {
+				counts[upper] += n
+			}
+		}
+	}
+	return counts
+}
+
+func TestBulkAnnounceSizeLimit(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{MaxBulkAnnounceSize: 2})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	var reqs []*announceclient.Request
+	for i := 0; i < 3; i++ {
+		blob := core.NewBlobFixture()
+		reqs = append(reqs, &announceclient.Request{
+			Digest:   &blob.Digest,
+			InfoHash: blob.MetaInfo.InfoHash(),
+			Peer:     core.PeerInfoFixture(),
+		})
+	}
+	body, err := json.Marshal(reqs)
+	require.NoError(err)
+
+	// No announces are made.
+	_, err = httputil.Post(
+		fmt.Sprintf("http://%s/announce/bulk", addr),
+		httputil.SendBody(bytes.NewReader(body)))
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
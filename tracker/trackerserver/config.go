@@ -24,12 +24,58 @@ type Config struct {
 	// Limits the number of unique metainfo requests to origin per namespace/digest.
 	GetMetaInfoLimit time.Duration `yaml:"get_metainfo_limit"`
 
-	// Limits the number of peers returned on each announce.
+	// Limits the number of peers returned on each announce. Announces which
+	// set num_want receive at most that many peers including origins, with at
+	// least one origin. Otherwise, up to PeerHandoutLimit peers are handed out
+	// plus all origins.
 	PeerHandoutLimit int `yaml:"announce_limit"`
 
 	AnnounceInterval time.Duration `yaml:"announce_interval"`
 
+	// Clients are told not to re-announce more often than this. Must not
+	// exceed AnnounceInterval. Defaults to half of AnnounceInterval.
+	MinAnnounceInterval time.Duration `yaml:"min_announce_interval"`
+
+	// Limits the encoded size of announce responses by truncating the peer
+	// handout, such that responses fit constrained paths. Disabled if 0.
+	MaxAnnounceResponseBytes int `yaml:"max_announce_response_bytes"`
+
+	// Bounds the time spent in storage per announce. Announces which exceed it
+	// fail with 503, even if origins are available. Disabled if 0.
+	AnnounceTimeout time.Duration `yaml:"announce_timeout"`
+
+	// Allows clients to cache their own announce responses for
+	// AnnounceInterval via Cache-Control: private. Shared caches may never
+	// store them, since the handout depends on the requester. Only applies to
+	// the per info hash announce endpoint. An announce served from cache never
+	// reaches the tracker, so the peer is not registered and eventually expires
+	// from the peer store. Only safe for read-only swarms whose peers are
+	// seeded by origins, hence disabled by default.
+	CacheAnnounceResponses bool `yaml:"cache_announce_responses"`
+
+	// Limits the number of in-flight announces per source IP. Disabled if 0.
+	PerIPAnnounceConcurrency int `yaml:"per_ip_announce_concurrency"`
+
+	// CIDRs of proxies, e.g. the local nginx, whose X-Forwarded-For and
+	// X-Real-IP headers are trusted to carry the source IP of announces.
+	// Headers from other sources are ignored.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// Limits the number of announces processed in parallel per bulk announce.
+	BulkAnnounceConcurrency int `yaml:"bulk_announce_concurrency"`
+
+	// Limits the number of announces in a single bulk announce.
+	MaxBulkAnnounceSize int `yaml:"max_bulk_announce_size"`
+
+	// Limits the number of info hashes in a single scrape.
+	MaxScrapeInfoHashes int `yaml:"max_scrape_info_hashes"`
+
 	Listener listener.Config `yaml:"listener"`
+
+	// AdminListener serves admin endpoints, such as /admin/log-level and
+	// /debug/policy/preview. Admin endpoints are disabled if unset. Must not be
+	// exposed publicly.
+	AdminListener listener.Config `yaml:"admin_listener"`
 }
 
 func (c Config) applyDefaults() Config {
@@ -42,5 +88,17 @@ func (c Config) applyDefaults() Config {
 	if c.AnnounceInterval == 0 {
 		c.AnnounceInterval = 3 * time.Second
 	}
+	if c.MinAnnounceInterval == 0 {
+		c.MinAnnounceInterval = c.AnnounceInterval / 2
+	}
+	if c.BulkAnnounceConcurrency == 0 {
+		c.BulkAnnounceConcurrency = 16
+	}
+	if c.MaxBulkAnnounceSize == 0 {
+		c.MaxBulkAnnounceSize = 256
+	}
+	if c.MaxScrapeInfoHashes == 0 {
+		c.MaxScrapeInfoHashes = 100
+	}
 	return c
 }
@@ -0,0 +1,74 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers which clients may use to bound how long the tracker works on their
+// request. X-Request-Deadline is an absolute unix time in milliseconds, and
+// X-Request-Timeout is a duration string (e.g. "500ms") relative to arrival.
+const (
+	_requestDeadlineHeader = "X-Request-Deadline"
+	_requestTimeoutHeader  = "X-Request-Timeout"
+)
+
+// parseRequestDeadline returns the deadline requested by the client of r, if any.
+func parseRequestDeadline(r *http.Request, now time.Time) (deadline time.Time, ok bool, err error) {
+	if v := r.Header.Get(_requestDeadlineHeader); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("parse %s: %s", _requestDeadlineHeader, err)
+		}
+		return time.Unix(0, ms*int64(time.Millisecond)), true, nil
+	}
+	if v := r.Header.Get(_requestTimeoutHeader); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("parse %s: %s", _requestTimeoutHeader, err)
+		}
+		return now.Add(timeout), true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+// requestDeadline bounds the request context by the client supplied deadline,
+// such that work is abandoned once the client has given up. Server side
+// timeouts still apply on top of the client deadline.
+func (s *Server) requestDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok, err := parseRequestDeadline(r, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !time.Now().Before(deadline) {
+			s.stats.Counter("request_deadline_exceeded_on_arrival").Inc(1)
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequestDeadline(t *testing.T) {
+	now := time.Unix(1000, 0)
+
+	tests := []struct {
+		desc     string
+		headers  map[string]string
+		deadline time.Time
+		ok       bool
+		err      bool
+	}{
+		{"none", nil, time.Time{}, false, false},
+		{"deadline", map[string]string{"X-Request-Deadline": "1000500"}, now.Add(500 * time.Millisecond), true, false},
+		{"timeout", map[string]string{"X-Request-Timeout": "2s"}, now.Add(2 * time.Second), true, false},
+		{"invalid deadline", map[string]string{"X-Request-Deadline": "soon"}, time.Time{}, false, true},
+		{"invalid timeout", map[string]string{"X-Request-Timeout": "10"}, time.Time{}, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			require := require.New(t)
+
+			r, err := http.NewRequest("GET", "/announce", nil)
+			require.NoError(err)
+			for k, v := range test.headers {
+				r.Header.Set(k, v)
+			}
+			deadline, ok, err := parseRequestDeadline(r, now)
+			if test.err {
+				require.Error(err)
+				return
+			}
+			require.NoError(err)
+			require.Equal(test.ok, ok)
+			require.True(test.deadline.Equal(deadline))
+		})
+	}
+}
+
+func TestRequestDeadlineExceededOnArrival(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	past := time.Now().Add(-time.Second).UnixNano() / int64(time.Millisecond)
+
+	_, err := sendAnnounce(addr, &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: blob.MetaInfo.InfoHash(),
+		Peer:     core.PeerInfoFixture(),
+	}, httputil.SendHeaders(map[string]string{"X-Request-Deadline": strconv.FormatInt(past, 10)}))
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusGatewayTimeout))
+}
+
+func TestRequestTimeoutCancelsPeerStore(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	canceled := make(chan error, 1)
+	mocks.peerStore.EXPECT().UpdatePeer(gomock.Any(), h, gomock.Any()).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(gomock.Any(), h, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, h core.InfoHash, n int) ([]*core.PeerInfo, error) {
+			<-ctx.Done()
+			canceled <- ctx.Err()
+			return nil, ctx.Err()
+		})
+
+	_, err := sendAnnounce(addr, &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: h,
+		Peer:     core.PeerInfoFixture(),
+	}, httputil.SendHeaders(map[string]string{"X-Request-Timeout": "100ms"}))
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusServiceUnavailable))
+
+	select {
+	case err := <-canceled:
+		require.Equal(context.DeadlineExceeded, err)
+	case <-time.After(time.Second):
+		require.FailNow("peer store was not canceled")
+	}
+}
+
+func TestRequestDeadlineMalformedHeader(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+
+	_, err := sendAnnounce(addr, &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: blob.MetaInfo.InfoHash(),
+		Peer:     core.PeerInfoFixture(),
+	}, httputil.SendHeaders(map[string]string{"X-Request-Timeout": "forever"}))
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import "sync"
+
+// ipLimiter limits the number of in-flight requests per source IP.
+type ipLimiter struct {
+	mu       sync.Mutex
+	limit    int
+	inflight map[string]int
+}
+
+func newIPLimiter(limit int) *ipLimiter {
+	return &ipLimiter{
+		limit:    limit,
+		inflight: make(map[string]int),
+	}
+}
+
+// acquire reserves a slot for ip. Returns false if ip has no slots left.
+func (l *ipLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.inflight[ip] >= l.limit {
+		return false
+	}
+	l.inflight[ip]++
+	return true
+}
+
+// release frees a slot previously reserved by acquire.
+func (l *ipLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inflight[ip]--
+	if l.inflight[ip] <= 0 {
+		delete(l.inflight, ip)
+	}
+}
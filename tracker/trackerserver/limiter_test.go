@@ -0,0 +1,134 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerIPAnnounceConcurrencyLimit(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{
+		PerIPAnnounceConcurrency: 1,
+		TrustedProxies:           []string{"127.0.0.1/32"},
+	})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	req := &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: h,
+		Peer:     core.PeerInfoFixture(),
+	}
+
+	// The first announce from 10.0.0.1 blocks in the peer store until released,
+	// holding the only slot for that IP.
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	gomock.InOrder(
+		mocks.peerStore.EXPECT().UpdatePeer(gomock.Any(), h, gomock.Any()).DoAndReturn(
+			func(context.Context, core.InfoHash, *core.PeerInfo) error {
+				close(blocked)
+				<-release
+				return nil
+			}),
+		mocks.peerStore.EXPECT().UpdatePeer(gomock.Any(), h, gomock.Any()).Return(nil))
+	mocks.peerStore.EXPECT().GetPeers(
+		gomock.Any(), h, gomock.Any()).Return([]*core.PeerInfo{core.PeerInfoFixture()}, nil).Times(2)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil).Times(2)
+
+	fromIP := func(ip string) httputil.SendOption {
+		return httputil.SendHeaders(map[string]string{"X-Real-IP": ip})
+	}
+
+	errc := make(chan error)
+	go func() {
+		_, err := sendAnnounce(addr, req, fromIP("10.0.0.1"))
+		errc <- err
+	}()
+	<-blocked
+
+	_, err := sendAnnounce(addr, req, fromIP("10.0.0.1"))
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+
+	// Other IPs are unaffected.
+	_, err = sendAnnounce(addr, req, fromIP("10.0.0.2"))
+	require.NoError(err)
+
+	close(release)
+	require.NoError(<-errc)
+}
+
+func TestPerIPAnnounceConcurrencyLimitIgnoresUntrustedHeaders(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{PerIPAnnounceConcurrency: 1})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+	req := &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: h,
+		Peer:     core.PeerInfoFixture(),
+	}
+
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	mocks.peerStore.EXPECT().UpdatePeer(gomock.Any(), h, gomock.Any()).DoAndReturn(
+		func(context.Context, core.InfoHash, *core.PeerInfo) error {
+			close(blocked)
+			<-release
+			return nil
+		})
+	mocks.peerStore.EXPECT().GetPeers(
+		gomock.Any(), h, gomock.Any()).Return([]*core.PeerInfo{core.PeerInfoFixture()}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	errc := make(chan error)
+	go func() {
+		_, err := sendAnnounce(
+			addr, req, httputil.SendHeaders(map[string]string{"X-Real-IP": "10.0.0.1"}))
+		errc <- err
+	}()
+	<-blocked
+
+	// A spoofed header does not get the client a fresh slot.
+	_, err := sendAnnounce(
+		addr, req, httputil.SendHeaders(map[string]string{"X-Real-IP": "10.0.0.2"}))
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusTooManyRequests))
+
+	close(release)
+	require.NoError(<-errc)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/uber-go/tally"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/peerhandoutpolicy"
+	"github.com/uber/kraken/utils/handler"
+)
+
+// previewPeer is a peer annotated with the priority a policy assigned it.
+type previewPeer struct {
+	Peer     *core.PeerInfo `json:"peer"`
+	Priority int            `json:"priority"`
+	Label    string         `json:"label"`
+}
+
+// policyPreviewHandler builds the handout the requester would receive for a
+// torrent using the given priority policy, without affecting the serving
+// policy, stored peers or handout metrics. Useful for vetting a policy change
+// against a live swarm.
+func (s *Server) policyPreviewHandler(w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	policy, err := peerhandoutpolicy.NewPriorityPolicy(tally.NoopScope, q.Get("priority"))
+	if err != nil {
+		return handler.Errorf("%s", err).Status(http.StatusBadRequest)
+	}
+	d, err := core.NewSHA256DigestFromHex(q.Get("digest"))
+	if err != nil {
+		return handler.Errorf("parse digest: %s", err).Status(http.StatusBadRequest)
+	}
+	h, err := core.NewInfoHashFromHex(q.Get("info_hash"))
+	if err != nil {
+		return handler.Errorf("parse info_hash: %s", err).Status(http.StatusBadRequest)
+	}
+	var numWant *int
+	if v := q.Get("numwant"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return handler.Errorf("parse numwant: %s", err).Status(http.StatusBadRequest)
+		}
+		numWant = &n
+	}
+	requester, err := parseRequester(q)
+	if err != nil {
+		return err
+	}
+	// Storage latencies of previews are not recorded, so they do not skew the
+	// metrics of the serving policy.
+	peers, err := s.getPeerHandout(r.Context(), tally.NoopScope, policy, d, h, requester, numWant)
+	if err != nil {
+		return err
+	}
+	result := make([]previewPeer, len(peers))
+	for i, p := range peers {
+		priority, label := policy.AssignPriority(p)
+		result[i] = previewPeer{p, priority, label}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
+
+// parseRequester builds the leecher a preview is built for from the
+// requester_* query parameters, which are validated like announced peers.
+// requester_peer_id is optional, and only used to exclude the requester from
+// its own handout.
+func parseRequester(q url.Values) (*core.PeerInfo, error) {
+	var errs []validationError
+
+	// Handouts do not depend on the requester's dc, so a preview for a given
+	// dc would be misleading.
+	if dc := q.Get("requester_dc"); dc != "" {
+		errs = append(errs, validationError{
+			"requester_dc", dc, "handouts do not depend on dc"})
+	}
+	requester := &core.PeerInfo{IP: q.Get("requester_ip")}
+	portParam := q.Get("requester_port")
+	port, err := strconv.Atoi(portParam)
+	if err != nil {
+		errs = append(errs, validationError{"requester_port", portParam, "expected int"})
+	} else {
+		requester.Port = port
+		errs = append(errs, validatePeerAddr(
+			requester.IP, requester.Port, "requester_ip", "requester_port")...)
+	}
+	if v := q.Get("requester_peer_id"); v != "" {
+		peerID, err := core.NewPeerID(v)
+		if err != nil {
+			errs = append(errs, validationError{"requester_peer_id", v, err.Error()})
+		}
+		requester.PeerID = peerID
+	}
+	if len(errs) > 0 {
+		return nil, newValidationError(errs)
+	}
+	return requester, nil
+}
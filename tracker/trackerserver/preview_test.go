@@ -0,0 +1,197 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+// previewURL returns the preview url on addr for a requester at ip.
+func previewURL(addr, priority string, blob *core.BlobFixture, ip string, params string) string {
+	return fmt.Sprintf(
+		"http://%s/debug/policy/preview?priority=%s&digest=%s&info_hash=%s"+
+			"&requester_ip=%s&requester_port=8080%s",
+		addr, priority, blob.Digest.Hex(), blob.MetaInfo.InfoHash().Hex(), ip, params)
+}
+
+func TestPolicyPreview(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{PeerHandoutLimit: 10})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.server().AdminHandler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	leecher := core.PeerInfoFixture()
+	seeder := core.PeerInfoFixture()
+	seeder.Complete = true
+	origin := core.OriginPeerInfoFixture()
+
+	mocks.peerStore.EXPECT().GetPeers(
+		gomock.Any(), h, 2).Return([]*core.PeerInfo{leecher, seeder}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return([]*core.PeerInfo{origin}, nil)
+
+	resp, err := httputil.Get(previewURL(addr, "completeness", blob, "10.0.0.1", "&numwant=2"))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	// The origin counts towards numwant, so the leecher is dropped.
+	var result []previewPeer
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal([]previewPeer{
+		{seeder, 0, "peer_seeder"},
+		{origin, 1, "origin"},
+	}, result)
+
+	// Previews do not skew the metrics of the serving policy.
+	snapshot := mocks.stats.(tally.TestScope).Snapshot()
+	for _, timer := range snapshot.Timers() {
+		require.NotEqual("testing.get_peers", timer.Name())
+	}
+	require.Empty(snapshot.Histograms())
+}
+
+func TestPolicyPreviewHandoutDependsOnRequester(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{PeerHandoutLimit: 10})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.server().AdminHandler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	h := blob.MetaInfo.InfoHash()
+
+	requester := core.NewPeerInfo(core.PeerIDFixture(), "10.0.0.1", 8080, false, false)
+	ipv4 := core.NewPeerInfo(core.PeerIDFixture(), "10.0.0.2", 8080, false, false)
+	ipv6 := core.NewPeerInfo(core.PeerIDFixture(), "2001:db8::1", 8080, false, false)
+
+	mocks.peerStore.EXPECT().GetPeers(gomock.Any(), h, gomock.Any()).Return(
+		[]*core.PeerInfo{requester, ipv4, ipv6}, nil).Times(2)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil).Times(2)
+
+	preview := func(ip string) []*core.PeerInfo {
+		resp, err := httputil.Get(previewURL(addr, "default", blob, ip, ""))
+		require.NoError(err)
+		defer resp.Body.Close()
+
+		var result []previewPeer
+		require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+		var peers []*core.PeerInfo
+		for _, p := range result {
+			peers = append(peers, p.Peer)
+		}
+		return peers
+	}
+
+	// The requester is excluded from its own handout, and IPv4 requesters do
+	// not receive IPv6 peers.
+	require.Equal([]*core.PeerInfo{ipv4}, preview("10.0.0.1"))
+	require.ElementsMatch([]*core.PeerInfo{requester, ipv4, ipv6}, preview("2001:db8::2"))
+}
+
+func TestPolicyPreviewInvalidRequester(t *testing.T) {
+	tests := []struct {
+		description string
+		params      string
+	}{
+		{"missing ip", "&requester_port=8080"},
+		{"invalid ip", "&requester_ip=not_an_ip&requester_port=8080"},
+		{"missing port", "&requester_ip=10.0.0.1"},
+		{"port out of range", "&requester_ip=10.0.0.1&requester_port=70000"},
+		{"invalid peer id", "&requester_ip=10.0.0.1&requester_port=8080&requester_peer_id=bogus"},
+		{"dc", "&requester_ip=10.0.0.1&requester_port=8080&requester_dc=dc1"},
+	}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t, Config{})
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.server().AdminHandler())
+			defer stop()
+
+			blob := core.NewBlobFixture()
+
+			_, err := httputil.Get(fmt.Sprintf(
+				"http://%s/debug/policy/preview?priority=default&digest=%s&info_hash=%s%s",
+				addr, blob.Digest.Hex(), blob.MetaInfo.InfoHash().Hex(), test.params))
+			require.Error(err)
+			require.True(httputil.IsStatus(err, http.StatusBadRequest))
+		})
+	}
+}
+
+func TestPolicyPreviewNumWantZero(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.server().AdminHandler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+
+	resp, err := httputil.Get(previewURL(addr, "completeness", blob, "10.0.0.1", "&numwant=0"))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var result []previewPeer
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Empty(result)
+}
+
+func TestPolicyPreviewUnknownPolicy(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.server().AdminHandler())
+	defer stop()
+
+	_, err := httputil.Get(previewURL(addr, "bogus", core.NewBlobFixture(), "10.0.0.1", ""))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
+
+func TestPolicyPreviewNotServedPublicly(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	_, err := httputil.Get(previewURL(addr, "default", core.NewBlobFixture(), "10.0.0.1", ""))
+	require.True(httputil.IsStatus(err, http.StatusNotFound))
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceIP(t *testing.T) {
+	tests := []struct {
+		desc           string
+		trustedProxies []string
+		remoteAddr     string
+		realIP         string
+		forwardedFor   string
+		expected       string
+	}{
+		{"no proxies trusted", nil, "10.0.0.1:80", "", "", "10.0.0.1"},
+		{"spoofed real ip ignored", nil, "10.0.0.1:80", "10.0.0.2", "", "10.0.0.1"},
+		{"spoofed forwarded for ignored", nil, "10.0.0.1:80", "", "10.0.0.2", "10.0.0.1"},
+		{"untrusted proxy ignored", []string{"192.0.2.0/24"}, "10.0.0.1:80", "10.0.0.2", "10.0.0.2", "10.0.0.1"},
+		{"trusted proxy real ip", []string{"10.0.0.0/24"}, "10.0.0.1:80", "10.0.0.2", "", "10.0.0.2"},
+		{"trusted proxy without headers", []string{"10.0.0.0/24"}, "10.0.0.1:80", "", "", "10.0.0.1"},
+		{"forwarded for preferred", []string{"10.0.0.0/24"}, "10.0.0.1:80", "10.0.0.2", "192.0.2.1", "192.0.2.1"},
+		{"forwarded for skips trusted hops", []string{"10.0.0.0/24"}, "10.0.0.1:80", "", "192.0.2.1, 10.0.0.3", "192.0.2.1"},
+		{"forwarded for ignores client supplied hops", []string{"10.0.0.0/24"}, "10.0.0.1:80", "", "1.2.3.4, 192.0.2.1", "192.0.2.1"},
+		{"malformed forwarded for", []string{"10.0.0.0/24"}, "10.0.0.1:80", "10.0.0.2", "bogus", "10.0.0.2"},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			mocks, cleanup := newServerMocks(t, Config{TrustedProxies: test.trustedProxies})
+			defer cleanup()
+
+			r := httptest.NewRequest("POST", "/announce", nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.realIP != "" {
+				r.Header.Set("X-Real-IP", test.realIP)
+			}
+			if test.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			require.Equal(t, test.expected, mocks.server().sourceIP(r))
+		})
+	}
+}
+
+func TestNewRejectsInvalidTrustedProxies(t *testing.T) {
+	mocks, cleanup := newServerMocks(t, Config{TrustedProxies: []string{"10.0.0.1"}})
+	defer cleanup()
+
+	_, err := New(
+		mocks.config,
+		mocks.stats,
+		mocks.policy,
+		mocks.peerStore,
+		mocks.originStore,
+		mocks.originCluster)
+	require.Error(t, err)
+}
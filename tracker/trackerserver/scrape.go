@@ -0,0 +1,64 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/handler"
+)
+
+// scrapeStats summarizes the peers of a single torrent.
+type scrapeStats struct {
+	Complete   int `json:"complete"`
+	Incomplete int `json:"incomplete"`
+}
+
+// scrapeResponse maps hex info hashes to their stats.
+type scrapeResponse struct {
+	Files map[string]scrapeStats `json:"files"`
+}
+
+// scrapeHandler returns seeder and leecher counts for each info_hash query
+// argument, up to MaxScrapeInfoHashes. Counts do not include origins.
+func (s *Server) scrapeHandler(w http.ResponseWriter, r *http.Request) error {
+	args := r.URL.Query()["info_hash"]
+	if len(args) == 0 {
+		return handler.Errorf("missing info_hash").Status(http.StatusBadRequest)
+	}
+	if len(args) > s.config.MaxScrapeInfoHashes {
+		return handler.Errorf(
+			"scrape of %d info hashes exceeds limit of %d",
+			len(args), s.config.MaxScrapeInfoHashes).Status(http.StatusBadRequest)
+	}
+	resp := scrapeResponse{Files: make(map[string]scrapeStats)}
+	for _, arg := range args {
+		h, err := core.NewInfoHashFromHex(arg)
+		if err != nil {
+			return handler.Errorf("parse info_hash: %s", err).Status(http.StatusBadRequest)
+		}
+		complete, incomplete, err := s.peerStore.CountPeers(r.Context(), h)
+		if err != nil {
+			return handler.Errorf("peer store: %s", err)
+		}
+		resp.Files[h.Hex()] = scrapeStats{Complete: complete, Incomplete: incomplete}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&resp); err != nil {
+		return handler.Errorf("json encode response: %s", err)
+	}
+	return nil
+}
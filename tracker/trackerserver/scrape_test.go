@@ -0,0 +1,92 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrape(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	h1 := core.InfoHashFixture()
+	h2 := core.InfoHashFixture()
+
+	mocks.peerStore.EXPECT().CountPeers(gomock.Any(), h1).Return(1, 2, nil)
+	mocks.peerStore.EXPECT().CountPeers(gomock.Any(), h2).Return(0, 0, nil)
+
+	resp, err := httputil.Get(
+		fmt.Sprintf("http://%s/scrape?info_hash=%s&info_hash=%s", addr, h1.Hex(), h2.Hex()))
+	require.NoError(err)
+	defer resp.Body.Close()
+
+	var result scrapeResponse
+	require.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(map[string]scrapeStats{
+		h1.Hex(): {Complete: 1, Incomplete: 2},
+		h2.Hex(): {},
+	}, result.Files)
+}
+
+func TestScrapeInfoHashLimit(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{MaxScrapeInfoHashes: 2})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	var args []string
+	for i := 0; i < 3; i++ {
+		args = append(args, "info_hash="+core.InfoHashFixture().Hex())
+	}
+	_, err := httputil.Get(
+		fmt.Sprintf("http://%s/scrape?%s", addr, strings.Join(args, "&")))
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+}
+
+func TestScrapeBadRequest(t *testing.T) {
+	for _, query := range []string{"", "?info_hash=bogus"} {
+		t.Run(query, func(t *testing.T) {
+			require := require.New(t)
+
+			mocks, cleanup := newServerMocks(t, Config{})
+			defer cleanup()
+
+			addr, stop := testutil.StartServer(mocks.handler())
+			defer stop()
+
+			_, err := httputil.Get(fmt.Sprintf("http://%s/scrape%s", addr, query))
+			require.True(httputil.IsStatus(err, http.StatusBadRequest))
+		})
+	}
+}
@@ -15,6 +15,7 @@ package trackerserver
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	_ "net/http/pprof" // Registers /debug/pprof endpoints in http.DefaultServeMux.
 
@@ -42,6 +43,9 @@ type Server struct {
 	policy      *peerhandoutpolicy.PriorityPolicy
 
 	originCluster blobclient.ClusterClient
+
+	announceLimiter *ipLimiter
+	trustedProxies  []*net.IPNet
 }
 
 // New creates a new Server.
@@ -51,22 +55,47 @@ func New(
 	policy *peerhandoutpolicy.PriorityPolicy,
 	peerStore peerstore.Store,
 	originStore originstore.Store,
-	originCluster blobclient.ClusterClient) *Server {
+	originCluster blobclient.ClusterClient) (*Server, error) {
 
 	config = config.applyDefaults()
+	if config.MinAnnounceInterval > config.AnnounceInterval {
+		return nil, fmt.Errorf(
+			"invalid config: min_announce_interval %s exceeds announce_interval %s",
+			config.MinAnnounceInterval, config.AnnounceInterval)
+	}
 
 	stats = stats.Tagged(map[string]string{
 		"module": "trackerserver",
 	})
 
-	return &Server{
-		config:        config,
-		stats:         stats,
-		peerStore:     peerStore,
-		originStore:   originStore,
-		policy:        policy,
-		originCluster: originCluster,
+	if config.BulkAnnounceConcurrency <= 0 {
+		return nil, fmt.Errorf(
+			"invalid config: bulk_announce_concurrency must be positive, got %d",
+			config.BulkAnnounceConcurrency)
+	}
+	if config.MaxBulkAnnounceSize <= 0 {
+		return nil, fmt.Errorf(
+			"invalid config: max_bulk_announce_size must be positive, got %d",
+			config.MaxBulkAnnounceSize)
+	}
+	trustedProxies, err := parseTrustedProxies(config.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: trusted_proxies: %s", err)
+	}
+
+	s := &Server{
+		config:         config,
+		stats:          stats,
+		peerStore:      peerStore,
+		originStore:    originStore,
+		policy:         policy,
+		originCluster:  originCluster,
+		trustedProxies: trustedProxies,
+	}
+	if config.PerIPAnnounceConcurrency > 0 {
+		s.announceLimiter = newIPLimiter(config.PerIPAnnounceConcurrency)
 	}
+	return s, nil
 }
 
 // Handler an http handler for s.
@@ -77,8 +106,14 @@ func (s *Server) Handler() http.Handler {
 	r.Use(middleware.LatencyTimer(s.stats))
 
 	r.Get("/health", handler.Wrap(s.healthHandler))
-	r.Get("/announce", handler.Wrap(s.announceHandlerV1))
-	r.Post("/announce/:infohash", handler.Wrap(s.announceHandlerV2))
+	r.Group(func(r chi.Router) {
+		r.Use(s.limitAnnounceConcurrency)
+		r.Use(s.requestDeadline)
+		r.Get("/announce", handler.Wrap(s.announceHandlerV1))
+		r.Post("/announce/bulk", handler.Wrap(s.bulkAnnounceHandler))
+		r.Post("/announce/:infohash", handler.Wrap(s.announceHandlerV2))
+	})
+	r.Get("/scrape", handler.Wrap(s.scrapeHandler))
 	r.Get("/namespace/:namespace/blobs/:digest/metainfo", handler.Wrap(s.getMetaInfoHandler))
 
 	r.Mount("/debug", chimiddleware.Profiler())
@@ -86,10 +121,50 @@ func (s *Server) Handler() http.Handler {
 	return r
 }
 
-// ListenAndServe is a blocking call which runs s.
+// AdminHandler returns an http handler for the admin endpoints of s.
+func (s *Server) AdminHandler() http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/admin/log-level", handler.Wrap(s.getLogLevelHandler))
+	r.Put("/admin/log-level", handler.Wrap(s.setLogLevelHandler))
+	r.Get("/debug/policy/preview", handler.Wrap(s.policyPreviewHandler))
+
+	return r
+}
+
+// ListenAndServe is a blocking call which runs s. Admin endpoints are served on
+// a separate listener, if configured.
 func (s *Server) ListenAndServe() error {
-	log.Infof("Starting tracker server on %s", s.config.Listener)
-	return listener.Serve(s.config.Listener, s.Handler())
+	errc := make(chan error, 2)
+	if s.config.AdminListener.Addr != "" {
+		go func() {
+			log.Infof("Starting tracker admin server on %s", s.config.AdminListener)
+			errc <- listener.Serve(s.config.AdminListener, s.AdminHandler())
+		}()
+	}
+	go func() {
+		log.Infof("Starting tracker server on %s", s.config.Listener)
+		errc <- listener.Serve(s.config.Listener, s.Handler())
+	}()
+	return <-errc
+}
+
+// limitAnnounceConcurrency rejects announces with 429 if the source IP already
+// has too many announces in flight.
+func (s *Server) limitAnnounceConcurrency(next http.Handler) http.Handler {
+	if s.announceLimiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := s.sourceIP(r)
+		if !s.announceLimiter.acquire(ip) {
+			s.stats.Counter("announce_concurrency_limited").Inc(1)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		defer s.announceLimiter.release(ip)
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) error {
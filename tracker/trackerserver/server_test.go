@@ -0,0 +1,51 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally"
+)
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		desc   string
+		config Config
+	}{
+		{"min interval above interval", Config{
+			AnnounceInterval:    time.Second,
+			MinAnnounceInterval: 2 * time.Second,
+		}},
+		{"negative bulk concurrency", Config{BulkAnnounceConcurrency: -1}},
+		{"negative bulk size", Config{MaxBulkAnnounceSize: -1}},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			mocks, cleanup := newServerMocks(t, Config{})
+			defer cleanup()
+
+			_, err := New(
+				test.config,
+				tally.NoopScope,
+				mocks.policy,
+				mocks.peerStore,
+				mocks.originStore,
+				mocks.originCluster)
+			require.Error(t, err)
+		})
+	}
+}
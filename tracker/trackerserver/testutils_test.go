@@ -48,12 +48,20 @@ func newServerMocks(t *testing.T, config Config) (*serverMocks, func()) {
 	}, ctrl.Finish
 }
 
-func (m *serverMocks) handler() http.Handler {
-	return New(
+func (m *serverMocks) server() *Server {
+	s, err := New(
 		m.config,
 		m.stats,
 		m.policy,
 		m.peerStore,
 		m.originStore,
-		m.originCluster).Handler()
+		m.originCluster)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func (m *serverMocks) handler() http.Handler {
+	return m.server().Handler()
 }
@@ -0,0 +1,130 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/handler"
+)
+
+// validationError describes a single invalid announce request field.
+type validationError struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+	Error string `json:"error"`
+}
+
+// validateAnnounceRequest checks every field of req and returns the parsed
+// digest. All invalid fields are reported together in a 400 error with a JSON
+// body, so that clients can fix them in one go.
+func validateAnnounceRequest(req *announceclient.Request) (core.Digest, error) {
+	var errs []validationError
+
+	d, err := req.GetDigest()
+	if err != nil {
+		errs = append(errs, validationError{"name", req.Name, err.Error()})
+	}
+	if req.Peer == nil {
+		errs = append(errs, validationError{"peer", "", "missing peer"})
+	} else {
+		errs = append(errs, validatePeerAddr(req.Peer.IP, req.Peer.Port, "peer.ip", "peer.port")...)
+	}
+	if len(errs) == 0 {
+		return d, nil
+	}
+	return core.Digest{}, newValidationError(errs)
+}
+
+// validatePeerAddr checks the ip and port a peer is reachable on, reporting
+// invalid values under the given field names.
+func validatePeerAddr(ip string, port int, ipField, portField string) []validationError {
+	var errs []validationError
+	if ip == "" {
+		errs = append(errs, validationError{ipField, "", "missing ip"})
+	} else if net.ParseIP(ip) == nil && !isValidHostname(ip) {
+		errs = append(errs, validationError{
+			ipField, ip, "neither an ip nor a valid hostname"})
+	}
+	if port <= 0 || port > 65535 {
+		errs = append(errs, validationError{
+			portField, strconv.Itoa(port), "port out of range"})
+	}
+	return errs
+}
+
+// decodeAnnounceRequest decodes an announce request from body. Fields of the
+// wrong type are reported like other invalid fields, except num_want, and
+// malformed json is rejected with 400.
+func decodeAnnounceRequest(body io.Reader) (*announceclient.Request, error) {
+	req := new(announceclient.Request)
+	if err := json.NewDecoder(body).Decode(req); err != nil {
+		if terr, ok := err.(*json.UnmarshalTypeError); ok {
+			if terr.Field == "num_want" {
+				// Invalid num_want falls back to the default limit, and the
+				// rest of the request is still decoded.
+				req.NumWant = nil
+				return req, nil
+			}
+			return nil, newValidationError([]validationError{{
+				terr.Field, terr.Value, fmt.Sprintf("expected %s", terr.Type)}})
+		}
+		return nil, handler.Errorf("json decode request: %s", err).Status(http.StatusBadRequest)
+	}
+	return req, nil
+}
+
+// newValidationError returns a 400 error with errs as its JSON body.
+func newValidationError(errs []validationError) error {
+	b, err := json.Marshal(errs)
+	if err != nil {
+		return handler.Errorf("json encode validation errors: %s", err)
+	}
+	return handler.Errorf("%s", b).
+		Status(http.StatusBadRequest).
+		Header("Content-Type", "application/json")
+}
+
+// isValidHostname returns whether host is a valid RFC 1123 hostname. Peers may
+// announce themselves by hostname, e.g. in containerized environments.
+func isValidHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(host, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
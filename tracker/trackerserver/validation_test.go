@@ -0,0 +1,188 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trackerserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/uber/kraken/core"
+	"github.com/uber/kraken/tracker/announceclient"
+	"github.com/uber/kraken/utils/handler"
+	"github.com/uber/kraken/utils/httputil"
+	"github.com/uber/kraken/utils/testutil"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAnnounceRequestReportsAllFields(t *testing.T) {
+	require := require.New(t)
+
+	peer := core.PeerInfoFixture()
+	peer.IP = "not_a_host!"
+	peer.Port = 0
+	req := &announceclient.Request{
+		Name:     "not a digest",
+		InfoHash: core.InfoHashFixture(),
+		Peer:     peer,
+	}
+
+	_, err := validateAnnounceRequest(req)
+	require.Error(err)
+	herr, ok := err.(*handler.Error)
+	require.True(ok)
+	require.Equal(http.StatusBadRequest, herr.GetStatus())
+
+	config := Config{}
+	mocks, cleanup := newServerMocks(t, config)
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	_, err = sendAnnounce(addr, req)
+	require.Error(err)
+	require.True(httputil.IsStatus(err, http.StatusBadRequest))
+
+	var errs []validationError
+	require.NoError(json.Unmarshal(
+		[]byte(err.(httputil.StatusError).ResponseDump), &errs))
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	require.Equal([]string{"name", "peer.ip", "peer.port"}, fields)
+}
+
+func TestValidateAnnounceRequestMissingPeer(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.NewBlobFixture()
+	_, err := validateAnnounceRequest(&announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: blob.MetaInfo.InfoHash(),
+	})
+	require.Error(err)
+	require.Contains(err.Error(), "missing peer")
+}
+
+func TestValidateAnnounceRequestValid(t *testing.T) {
+	require := require.New(t)
+
+	blob := core.NewBlobFixture()
+	d, err := validateAnnounceRequest(&announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: blob.MetaInfo.InfoHash(),
+		Peer:     core.PeerInfoFixture(),
+	})
+	require.NoError(err)
+	require.Equal(blob.Digest, d)
+}
+
+func TestIsValidHostname(t *testing.T) {
+	for _, host := range []string{
+		"localhost", "tracker-01.example.com", "host.", "a1",
+	} {
+		require.True(t, isValidHostname(host), host)
+	}
+	for _, host := range []string{
+		"", ".", "under_score", "-leading", "trailing-", "a..b", "spa ce",
+		strings.Repeat("a", 64) + ".com",
+	} {
+		require.False(t, isValidHostname(host), host)
+	}
+}
+
+func TestAnnounceWithHostname(t *testing.T) {
+	require := require.New(t)
+
+	mocks, cleanup := newServerMocks(t, Config{})
+	defer cleanup()
+
+	addr, stop := testutil.StartServer(mocks.handler())
+	defer stop()
+
+	blob := core.NewBlobFixture()
+	peer := core.PeerInfoFixture()
+	peer.IP = "localhost"
+
+	mocks.peerStore.EXPECT().UpdatePeer(
+		gomock.Any(), blob.MetaInfo.InfoHash(), peer).Return(nil)
+	mocks.peerStore.EXPECT().GetPeers(
+		gomock.Any(), blob.MetaInfo.InfoHash(), gomock.Any()).Return(
+		[]*core.PeerInfo{core.PeerInfoFixture()}, nil)
+	mocks.originStore.EXPECT().GetOrigins(blob.Digest).Return(nil, nil)
+
+	resp, err := sendAnnounce(addr, &announceclient.Request{
+		Digest:   &blob.Digest,
+		InfoHash: blob.MetaInfo.InfoHash(),
+		Peer:     peer,
+	})
+	require.NoError(err)
+	resp.Body.Close()
+}
+
+func TestAnnounceMalformedBody(t *testing.T) {
+	blob := core.NewBlobFixture()
+	tests := []struct {
+		desc   string
+		body   string
+		fields []string
+	}{
+		{"type mismatch", fmt.Sprintf(
+			`{"digest": %q, "peer": {"ip": "10.0.0.1", "port": "http"}}`, blob.Digest), []string{"peer.port"}},
+		{"malformed json", `{"peer": `, nil},
+	}
+	for _, test := range tests {
+		for _, endpoint := range []string{"announce", "announce/" + blob.MetaInfo.InfoHash().Hex()} {
+			t.Run(test.desc+" "+endpoint, func(t *testing.T) {
+				require := require.New(t)
+
+				mocks, cleanup := newServerMocks(t, Config{})
+				defer cleanup()
+
+				addr, stop := testutil.StartServer(mocks.handler())
+				defer stop()
+
+				url := fmt.Sprintf("http://%s/%s", addr, endpoint)
+				body := httputil.SendBody(bytes.NewBufferString(test.body))
+				var err error
+				if endpoint == "announce" {
+					_, err = httputil.Get(url, body)
+				} else {
+					_, err = httputil.Post(url, body)
+				}
+				require.Error(err)
+				require.True(httputil.IsStatus(err, http.StatusBadRequest), err.Error())
+
+				if test.fields == nil {
+					return
+				}
+				var errs []validationError
+				require.NoError(json.Unmarshal(
+					[]byte(err.(httputil.StatusError).ResponseDump), &errs))
+				var fields []string
+				for _, e := range errs {
+					fields = append(fields, e.Field)
+				}
+				require.Equal(test.fields, fields)
+			})
+		}
+	}
+}
@@ -24,6 +24,7 @@ import (
 
 var (
 	_default *zap.SugaredLogger
+	_level   zap.AtomicLevel
 )
 
 // configure a default logger
@@ -47,9 +48,32 @@ func ConfigureLogger(zapConfig zap.Config) *zap.SugaredLogger {
 	logger = logger.WithOptions(zap.AddCallerSkip(1))
 
 	_default = logger.Sugar()
+	_level = zapConfig.Level
 	return _default
 }
 
+// ReplaceLogger configures the global logger like ConfigureLogger, and returns
+// a function which restores the previous logger and level. Useful for capturing
+// log output in tests.
+func ReplaceLogger(zapConfig zap.Config) (restore func()) {
+	prevDefault, prevLevel := _default, _level
+	ConfigureLogger(zapConfig)
+	return func() {
+		_default, _level = prevDefault, prevLevel
+	}
+}
+
+// GetLevel returns the level of the global logger.
+func GetLevel() zapcore.Level {
+	return _level.Level()
+}
+
+// SetLevel changes the level of the global logger at runtime. Takes effect for
+// all subsequent log calls.
+func SetLevel(l zapcore.Level) {
+	_level.SetLevel(l)
+}
+
 // Default returns the default global logger.
 func Default() *zap.SugaredLogger {
 	return _default